@@ -0,0 +1,121 @@
+package adspots
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// LearningSelector is implemented by selectors that learn from how the
+// candidates performed so far. The server then calls SelectWithStats with
+// the impressions and clicks each candidate received on the placement.
+type LearningSelector interface {
+	Selector
+	SelectWithStats(placement Placement, candidates []AdSpot, stats map[string]Counts) AdSpot
+}
+
+// ThompsonSelector treats each placement as a multi-armed bandit. It draws a
+// CTR for every candidate from the Beta posterior of its clicks and
+// impressions, and picks the highest draw, so that traffic shifts towards the
+// best performing ad spots while the others keep being explored.
+type ThompsonSelector struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewThompsonSelector returns a selector whose draws are fully determined by
+// the seed.
+func NewThompsonSelector(seed uint64) *ThompsonSelector {
+	return &ThompsonSelector{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Select picks among candidates without any stats, which all share the same
+// uniform prior.
+func (ts *ThompsonSelector) Select(placement Placement, candidates []AdSpot) AdSpot {
+	return ts.SelectWithStats(placement, candidates, nil)
+}
+
+func (ts *ThompsonSelector) SelectWithStats(_ Placement, candidates []AdSpot, stats map[string]Counts) AdSpot {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	best, bestDraw := candidates[0], -1.0
+	for _, spot := range candidates {
+		counts := stats[spot.ID]
+		// Clicks can outnumber impressions when some impressions are lost
+		failures := max(counts.Impressions-counts.Clicks, 0)
+		if draw := ts.beta(float64(counts.Clicks)+1, float64(failures)+1); draw > bestDraw {
+			best, bestDraw = spot, draw
+		}
+	}
+	return best
+}
+
+// beta draws from a Beta(a, b) distribution, as the ratio of two Gamma draws.
+func (ts *ThompsonSelector) beta(a, b float64) float64 {
+	x := ts.gamma(a)
+	y := ts.gamma(b)
+	return x / (x + y)
+}
+
+// gamma draws from a Gamma(shape, 1) distribution with Marsaglia and Tsang's
+// method, which requires a shape of at least 1.
+func (ts *ThompsonSelector) gamma(shape float64) float64 {
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := ts.rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := ts.rng.Float64()
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
+
+// selectAdSpot picks among the candidates with the server's selector, feeding
+// it the candidates' stats if it learns from them.
+func (s *Server) selectAdSpot(ctx context.Context, placement Placement, candidates []AdSpot) (AdSpot, error) {
+	learner, ok := s.selector.(LearningSelector)
+	if !ok {
+		return s.selector.Select(placement, candidates), nil
+	}
+
+	ids := make([]string, 0, len(candidates))
+	for _, spot := range candidates {
+		ids = append(ids, spot.ID)
+	}
+	stats, err := s.store.AdSpotCounts(ctx, placement, ids)
+	if err != nil {
+		return AdSpot{}, err
+	}
+	return learner.SelectWithStats(placement, candidates, stats), nil
+}
+
+func (gs *GormStore) AdSpotCounts(ctx context.Context, placement Placement, ids []string) (map[string]Counts, error) {
+	var rows []struct {
+		AdSpotID    string
+		Impressions int64
+		Clicks      int64
+	}
+	err := gorm.G[EventRollup](gs.db).
+		Select("ad_spot_id, SUM(impressions) AS impressions, SUM(clicks) AS clicks").
+		Where("placement = ? AND ad_spot_id IN ?", placement, ids).
+		Group("ad_spot_id").
+		Scan(ctx, &rows)
+
+	stats := make(map[string]Counts, len(rows))
+	for _, row := range rows {
+		var counts Counts
+		counts.add(row.Impressions, row.Clicks)
+		stats[row.AdSpotID] = counts
+	}
+	return stats, err
+}
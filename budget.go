@@ -0,0 +1,267 @@
+package adspots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	PricingModel int
+	PacingMode   int
+
+	// CampaignSpend holds the amount a campaign spent on a given UTC day, in
+	// billionths of the currency unit, so that CPM rates add up exactly one
+	// impression at a time. It is kept up to date as events are recorded.
+	CampaignSpend struct {
+		CampaignID string  `gorm:"primaryKey"`
+		Day        ISO8601 `gorm:"primaryKey"`
+		SpendNanos int64
+	}
+
+	// BudgetState reports how much of its budgets a campaign spent. Only the
+	// budgets the campaign actually has are filled in.
+	BudgetState struct {
+		TodayMicros             int64  `json:"todayMicros"`
+		LifetimeMicros          int64  `json:"lifetimeMicros"`
+		DailyRemainingMicros    *int64 `json:"dailyRemainingMicros,omitempty"`
+		LifetimeRemainingMicros *int64 `json:"lifetimeRemainingMicros,omitempty"`
+		Exhausted               bool   `json:"exhausted"`
+		Throttled               bool   `json:"throttled"`
+	}
+)
+
+// Campaigns are charged per thousand impressions, or per click.
+const (
+	PricingCPM PricingModel = 1
+	PricingCPC PricingModel = 2
+)
+
+// Even pacing spreads the daily budget over the day, while ASAP pacing lets
+// the campaign spend it as fast as it is served.
+const (
+	PacingEven PacingMode = 1
+	PacingASAP PacingMode = 2
+)
+
+var InvalidPricingModel = errors.New("invalid pricing model value")
+var InvalidPacingMode = errors.New("invalid pacing mode value")
+
+func (m PricingModel) String() string {
+	switch m {
+	case PricingCPM:
+		return "cpm"
+	case PricingCPC:
+		return "cpc"
+	}
+	return "invalid"
+}
+
+func (m *PricingModel) Parse(value string) error {
+	switch value {
+	case "cpm":
+		*m = PricingCPM
+	case "cpc":
+		*m = PricingCPC
+	default:
+		return InvalidPricingModel
+	}
+	return nil
+}
+
+func (m PricingModel) MarshalJSON() ([]byte, error) {
+	return fmt.Appendf([]byte{}, "%q", m.String()), nil
+}
+
+func (m *PricingModel) UnmarshalJSON(buf []byte) error {
+	value := strings.Trim(string(buf), `"`)
+	return m.Parse(value)
+}
+
+func (p PacingMode) String() string {
+	switch p {
+	case PacingEven:
+		return "even"
+	case PacingASAP:
+		return "asap"
+	}
+	return "invalid"
+}
+
+func (p *PacingMode) Parse(value string) error {
+	switch value {
+	case "even":
+		*p = PacingEven
+	case "asap":
+		*p = PacingASAP
+	default:
+		return InvalidPacingMode
+	}
+	return nil
+}
+
+func (p PacingMode) MarshalJSON() ([]byte, error) {
+	return fmt.Appendf([]byte{}, "%q", p.String()), nil
+}
+
+func (p *PacingMode) UnmarshalJSON(buf []byte) error {
+	value := strings.Trim(string(buf), `"`)
+	return p.Parse(value)
+}
+
+// spendDay returns the UTC day an instant falls into.
+func spendDay(t time.Time) ISO8601 {
+	return ISO8601(t.UTC().Truncate(24 * time.Hour))
+}
+
+// budgeted reports whether the campaign has any budget to enforce.
+func (c Campaign) budgeted() bool {
+	return c.DailyBudgetMicros != nil || c.LifetimeBudgetMicros != nil
+}
+
+// cost returns what the campaign is charged for the event, in billionths of
+// the currency unit. A CPM rate in micros is exactly the cost of a single
+// impression in nanos.
+func (c Campaign) cost(kind EventType) int64 {
+	switch {
+	case c.Pricing == nil:
+		return 0
+	case *c.Pricing == PricingCPM && kind == EventImpression:
+		return c.RateMicros
+	case *c.Pricing == PricingCPC && kind == EventClick:
+		return c.RateMicros * 1000
+	}
+	return 0
+}
+
+// pacedBudget returns how much of its daily budget the campaign may have
+// spent by now. Even pacing releases the budget linearly over the UTC day,
+// with an hour's worth up front so that serving can start at midnight.
+func (c Campaign) pacedBudget(now time.Time) int64 {
+	daily := *c.DailyBudgetMicros
+	if c.Pacing == PacingASAP {
+		return daily
+	}
+	elapsed := now.UTC().Sub(time.Time(spendDay(now))) + time.Hour
+	return min(daily, int64(float64(daily)*elapsed.Hours()/24))
+}
+
+// accrueSpend charges the event to the campaign it was recorded for, on the
+// day it was received: the timestamp comes from the client, which mustn't get
+// to pick the budget it is charged to.
+func accrueSpend(ctx context.Context, tx *gorm.DB, event Event, campaign Campaign, now time.Time) error {
+	cost := campaign.cost(event.Type)
+	if cost == 0 {
+		return nil
+	}
+
+	spend := CampaignSpend{
+		CampaignID: campaign.ID,
+		Day:        spendDay(now),
+		SpendNanos: cost,
+	}
+	upsert := clause.OnConflict{
+		Columns: []clause.Column{{Name: "campaign_id"}, {Name: "day"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "spend_nanos"}, Value: gorm.Expr("campaign_spends.spend_nanos + excluded.spend_nanos")},
+		},
+	}
+	return gorm.G[CampaignSpend](tx, upsert).Create(ctx, &spend)
+}
+
+// budgetStates computes the budget state of every budgeted campaign.
+func (s *Server) budgetStates(ctx context.Context, campaigns []Campaign, now time.Time) (map[string]BudgetState, error) {
+	var ids []string
+	for _, campaign := range campaigns {
+		if campaign.budgeted() {
+			ids = append(ids, campaign.ID)
+		}
+	}
+
+	states := make(map[string]BudgetState, len(ids))
+	if len(ids) == 0 {
+		return states, nil
+	}
+
+	spent, err := s.store.CampaignSpend(ctx, ids, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, campaign := range campaigns {
+		if !campaign.budgeted() {
+			continue
+		}
+
+		state := spent[campaign.ID]
+		if campaign.DailyBudgetMicros != nil {
+			remaining := max(*campaign.DailyBudgetMicros-state.TodayMicros, 0)
+			state.DailyRemainingMicros = &remaining
+			state.Exhausted = remaining == 0
+			state.Throttled = !state.Exhausted && state.TodayMicros >= campaign.pacedBudget(now)
+		}
+		if campaign.LifetimeBudgetMicros != nil {
+			remaining := max(*campaign.LifetimeBudgetMicros-state.LifetimeMicros, 0)
+			state.LifetimeRemainingMicros = &remaining
+			state.Exhausted = state.Exhausted || remaining == 0
+		}
+		states[campaign.ID] = state
+	}
+	return states, nil
+}
+
+// withinBudget drops the ad spots whose campaign exhausted its budget, or is
+// ahead of its pacing.
+func (s *Server) withinBudget(ctx context.Context, spots []AdSpot, now time.Time) ([]AdSpot, error) {
+	var ids []string
+	for _, spot := range spots {
+		if spot.CampaignID != nil && !slices.Contains(ids, *spot.CampaignID) {
+			ids = append(ids, *spot.CampaignID)
+		}
+	}
+	if len(ids) == 0 {
+		return spots, nil
+	}
+
+	campaigns, err := s.store.ListCampaigns(ctx, CampaignFilter{IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	states, err := s.budgetStates(ctx, campaigns, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(spots, func(a AdSpot) bool {
+		if a.CampaignID == nil {
+			return false
+		}
+		state := states[*a.CampaignID]
+		return state.Exhausted || state.Throttled
+	}), nil
+}
+
+func (gs *GormStore) CampaignSpend(ctx context.Context, ids []string, now time.Time) (map[string]BudgetState, error) {
+	var rows []struct {
+		CampaignID string
+		Today      int64
+		Lifetime   int64
+	}
+	err := gorm.G[CampaignSpend](gs.db).
+		Select("campaign_id, SUM(CASE WHEN day = ? THEN spend_nanos ELSE 0 END) AS today, SUM(spend_nanos) AS lifetime", spendDay(now)).
+		Where("campaign_id IN ?", ids).
+		Group("campaign_id").
+		Scan(ctx, &rows)
+
+	spent := make(map[string]BudgetState, len(rows))
+	for _, row := range rows {
+		spent[row.CampaignID] = BudgetState{TodayMicros: row.Today / 1000, LifetimeMicros: row.Lifetime / 1000}
+	}
+	return spent, err
+}
@@ -0,0 +1,536 @@
+package adspots
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type (
+	Advertiser struct {
+		ID        string  `json:"id" gorm:"primaryKey"`
+		Name      string  `json:"name"`
+		CreatedAt ISO8601 `json:"createdAt"`
+	}
+
+	// Campaign groups the ad spots of an advertiser. Its ad spots are only
+	// served while the campaign is active, whatever their own status, and
+	// while it has budget left. Amounts are in millionths of the currency.
+	Campaign struct {
+		ID                   string        `json:"id" gorm:"primaryKey"`
+		AdvertiserID         string        `json:"advertiserId" gorm:"index"`
+		Name                 string        `json:"name"`
+		Status               Status        `json:"status"`
+		CreatedAt            ISO8601       `json:"createdAt"`
+		DailyBudgetMicros    *int64        `json:"dailyBudgetMicros,omitempty"`
+		LifetimeBudgetMicros *int64        `json:"lifetimeBudgetMicros,omitempty"`
+		Pricing              *PricingModel `json:"pricing,omitempty"`
+		RateMicros           int64         `json:"rateMicros,omitempty"`
+		Pacing               PacingMode    `json:"pacing" gorm:"default:1"`
+		Budget               *BudgetState  `json:"budget,omitempty" gorm:"-"`
+	}
+
+	AdvertiserPayload struct {
+		Name *string `json:"name"`
+	}
+	CampaignPayload struct {
+		AdvertiserID         *string       `json:"advertiserId"`
+		Name                 *string       `json:"name"`
+		Status               *Status       `json:"status"`
+		DailyBudgetMicros    *int64        `json:"dailyBudgetMicros"`
+		LifetimeBudgetMicros *int64        `json:"lifetimeBudgetMicros"`
+		Pricing              *PricingModel `json:"pricing"`
+		RateMicros           *int64        `json:"rateMicros"`
+		Pacing               *PacingMode   `json:"pacing"`
+	}
+)
+
+// CampaignStore persists advertisers and their campaigns, along with what
+// the campaigns spent.
+type CampaignStore interface {
+	CreateAdvertiser(ctx context.Context, advertiser Advertiser) error
+	// GetAdvertiser returns the advertiser with the given ID, or
+	// AdvertiserNotFound.
+	GetAdvertiser(ctx context.Context, id string) (Advertiser, error)
+	// ListAdvertisers returns every advertiser, newest first.
+	ListAdvertisers(ctx context.Context) ([]Advertiser, error)
+	// UpdateAdvertiser stores the name of the advertiser.
+	UpdateAdvertiser(ctx context.Context, advertiser Advertiser) error
+	DeleteAdvertiser(ctx context.Context, id string) error
+	CreateCampaign(ctx context.Context, campaign Campaign) error
+	// GetCampaign returns the campaign with the given ID, or
+	// CampaignNotFound.
+	GetCampaign(ctx context.Context, id string) (Campaign, error)
+	// ListCampaigns returns the campaigns matching the filter, newest first.
+	ListCampaigns(ctx context.Context, filter CampaignFilter) ([]Campaign, error)
+	// UpdateCampaign stores the editable fields of the campaign.
+	UpdateCampaign(ctx context.Context, campaign Campaign) error
+	DeleteCampaign(ctx context.Context, id string) error
+	// CampaignSpend returns what each of the campaigns spent on the UTC day
+	// of now and in total, as the TodayMicros and LifetimeMicros of a budget
+	// state. Campaigns that spent nothing are left out.
+	CampaignSpend(ctx context.Context, ids []string, now time.Time) (map[string]BudgetState, error)
+}
+
+// CampaignFilter selects the campaigns returned by CampaignStore.ListCampaigns.
+// The zero value selects every campaign.
+type CampaignFilter struct {
+	// IDs, if not empty, keeps the campaigns with one of these IDs.
+	IDs          []string
+	AdvertiserID *string
+}
+
+var AdvertiserNotFound = errors.New("advertiser not found")
+var CampaignNotFound = errors.New("campaign not found")
+
+func (p AdvertiserPayload) validate() []string {
+	var validationErrors []string
+	if p.Name == nil || *p.Name == "" {
+		validationErrors = append(validationErrors, "Name field cannot be missing")
+	}
+	return validationErrors
+}
+
+// validate checks the payload, without looking up the advertiser. Campaigns
+// are switched on and off directly, so they have no draft or archived state,
+// but otherwise move between statuses like ad spots do.
+func (p CampaignPayload) validate() []string {
+	var validationErrors []string
+	if p.AdvertiserID == nil || *p.AdvertiserID == "" {
+		validationErrors = append(validationErrors, "Advertiser ID field cannot be missing")
+	}
+	if p.Name == nil || *p.Name == "" {
+		validationErrors = append(validationErrors, "Name field cannot be missing")
+	}
+	if p.Status != nil && *p.Status != StatusActive && *p.Status != StatusPaused && *p.Status != StatusDeactivated {
+		validationErrors = append(validationErrors, "Campaigns can only be active, paused or deactivated")
+	}
+	if p.DailyBudgetMicros != nil && *p.DailyBudgetMicros <= 0 {
+		validationErrors = append(validationErrors, "Daily budget field must be positive")
+	}
+	if p.LifetimeBudgetMicros != nil && *p.LifetimeBudgetMicros <= 0 {
+		validationErrors = append(validationErrors, "Lifetime budget field must be positive")
+	}
+	if (p.DailyBudgetMicros != nil || p.LifetimeBudgetMicros != nil) && p.Pricing == nil {
+		validationErrors = append(validationErrors, "Budgeted campaigns must have a pricing model")
+	}
+	if (p.Pricing != nil) != (p.RateMicros != nil) {
+		validationErrors = append(validationErrors, "Pricing and rate fields must be given together")
+	} else if p.RateMicros != nil && *p.RateMicros <= 0 {
+		validationErrors = append(validationErrors, "Rate field must be positive")
+	}
+	return validationErrors
+}
+
+func (c Campaign) payload() CampaignPayload {
+	payload := CampaignPayload{
+		AdvertiserID:         &c.AdvertiserID,
+		Name:                 &c.Name,
+		Status:               &c.Status,
+		DailyBudgetMicros:    c.DailyBudgetMicros,
+		LifetimeBudgetMicros: c.LifetimeBudgetMicros,
+		Pricing:              c.Pricing,
+		Pacing:               &c.Pacing,
+	}
+	if c.Pricing != nil {
+		payload.RateMicros = &c.RateMicros
+	}
+	return payload
+}
+
+// campaignColumns are the columns written when a campaign is updated.
+var campaignColumns = []string{
+	"name", "status", "daily_budget_micros", "lifetime_budget_micros", "pricing", "rate_micros", "pacing",
+}
+
+// apply overwrites the editable fields of the campaign with a validated
+// payload, leaving its status alone if the payload doesn't set one.
+func (c *Campaign) apply(p CampaignPayload) {
+	c.Name = *p.Name
+	if p.Status != nil {
+		c.Status = *p.Status
+	}
+	c.DailyBudgetMicros = p.DailyBudgetMicros
+	c.LifetimeBudgetMicros = p.LifetimeBudgetMicros
+	c.Pricing = p.Pricing
+	c.RateMicros = 0
+	if p.RateMicros != nil {
+		c.RateMicros = *p.RateMicros
+	}
+	c.Pacing = PacingEven
+	if p.Pacing != nil {
+		c.Pacing = *p.Pacing
+	}
+}
+
+// exists reports whether get finds the row with the given ID, rather than
+// failing with notFound.
+func exists[T any](ctx context.Context, get func(context.Context, string) (T, error), id string, notFound error) (bool, error) {
+	_, err := get(ctx, id)
+	if errors.Is(err, notFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// validateCampaign checks that the ad spot's campaign, if any, exists.
+func (s *Server) validateCampaign(ctx context.Context, p CreatePayload) ([]string, error) {
+	if p.CampaignID == nil {
+		return nil, nil
+	}
+	found, err := exists(ctx, s.store.GetCampaign, *p.CampaignID, CampaignNotFound)
+	if err != nil || found {
+		return nil, err
+	}
+	return []string{"Could not find campaign with requested campaign ID"}, nil
+}
+
+func (s *Server) CreateAdvertiser(w http.ResponseWriter, r *http.Request) {
+	var payload AdvertiserPayload
+	if !decodeStrict(w, r.Body, &payload) {
+		return
+	}
+
+	if validationErrors := payload.validate(); len(validationErrors) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Failed to validate JSON payload",
+			"context": validationErrors,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	advertiser := Advertiser{
+		ID:        uuid.NewString(),
+		Name:      *payload.Name,
+		CreatedAt: ISO8601(time.Now()),
+	}
+	if err := s.store.CreateAdvertiser(r.Context(), advertiser); err != nil {
+		JSONError(w, map[string]any{
+			"what":    "Failed to persist advertiser",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	JSONResponse(w, advertiser, http.StatusCreated)
+}
+
+func (s *Server) GetAdvertiser(w http.ResponseWriter, r *http.Request) {
+	if advertiser, ok := loadWith(w, r, "advertiser", s.store.GetAdvertiser, AdvertiserNotFound); ok {
+		JSONResponse(w, advertiser, http.StatusOK)
+	}
+}
+
+func (s *Server) ListAdvertisers(w http.ResponseWriter, r *http.Request) {
+	advertisers, err := s.store.ListAdvertisers(r.Context())
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	if advertisers == nil {
+		advertisers = []Advertiser{}
+	}
+	JSONResponse(w, map[string]any{"data": advertisers}, http.StatusOK)
+}
+
+// PatchAdvertiser applies a JSON merge patch to the advertiser.
+func (s *Server) PatchAdvertiser(w http.ResponseWriter, r *http.Request) {
+	advertiser, ok := loadWith(w, r, "advertiser", s.store.GetAdvertiser, AdvertiserNotFound)
+	if !ok {
+		return
+	}
+
+	var payload AdvertiserPayload
+	if !decodeMergePatch(w, r.Body, AdvertiserPayload{Name: &advertiser.Name}, &payload) {
+		return
+	}
+	if validationErrors := payload.validate(); len(validationErrors) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Failed to validate JSON payload",
+			"context": validationErrors,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	advertiser.Name = *payload.Name
+	if err := s.store.UpdateAdvertiser(r.Context(), advertiser); err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database update",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	JSONResponse(w, advertiser, http.StatusOK)
+}
+
+// DeleteAdvertiser removes an advertiser, which must have no campaigns left.
+func (s *Server) DeleteAdvertiser(w http.ResponseWriter, r *http.Request) {
+	advertiser, ok := loadWith(w, r, "advertiser", s.store.GetAdvertiser, AdvertiserNotFound)
+	if !ok {
+		return
+	}
+
+	campaigns, err := s.store.ListCampaigns(r.Context(), CampaignFilter{AdvertiserID: &advertiser.ID})
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Database request failed",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	if len(campaigns) > 0 {
+		JSONError(w, map[string]any{
+			"what":      "Advertiser still has campaigns",
+			"campaigns": len(campaigns),
+		}, http.StatusConflict)
+		return
+	}
+
+	if err := s.store.DeleteAdvertiser(r.Context(), advertiser.ID); err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database update",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var payload CampaignPayload
+	if !decodeStrict(w, r.Body, &payload) {
+		return
+	}
+
+	validationErrors := payload.validate()
+	if len(validationErrors) == 0 {
+		found, err := exists(r.Context(), s.store.GetAdvertiser, *payload.AdvertiserID, AdvertiserNotFound)
+		if err != nil {
+			JSONError(w, map[string]string{
+				"what":    "Database request failed",
+				"context": err.Error(),
+			}, http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			validationErrors = append(validationErrors, "Could not find advertiser with requested advertiser ID")
+		}
+	}
+	if len(validationErrors) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Failed to validate JSON payload",
+			"context": validationErrors,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	campaign := Campaign{
+		ID:           uuid.NewString(),
+		AdvertiserID: *payload.AdvertiserID,
+		Status:       StatusActive,
+		CreatedAt:    ISO8601(time.Now()),
+	}
+	campaign.apply(payload)
+
+	if err := s.store.CreateCampaign(r.Context(), campaign); err != nil {
+		JSONError(w, map[string]any{
+			"what":    "Failed to persist campaign",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	JSONResponse(w, campaign, http.StatusCreated)
+}
+
+// GetCampaign returns the campaign along with the state of its budgets.
+func (s *Server) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := loadWith(w, r, "campaign", s.store.GetCampaign, CampaignNotFound)
+	if !ok {
+		return
+	}
+
+	states, err := s.budgetStates(r.Context(), []Campaign{campaign}, time.Now())
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Database request failed",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	if state, ok := states[campaign.ID]; ok {
+		campaign.Budget = &state
+	}
+
+	JSONResponse(w, campaign, http.StatusOK)
+}
+
+// ListCampaigns lists every campaign, or those of the advertiserId parameter.
+func (s *Server) ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	var filter CampaignFilter
+	if advertiserID := r.URL.Query().Get("advertiserId"); advertiserID != "" {
+		filter.AdvertiserID = &advertiserID
+	}
+
+	campaigns, err := s.store.ListCampaigns(r.Context(), filter)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	if campaigns == nil {
+		campaigns = []Campaign{}
+	}
+	JSONResponse(w, map[string]any{"data": campaigns}, http.StatusOK)
+}
+
+// PatchCampaign applies a JSON merge patch to the campaign. Changing its
+// status or budgets immediately shows or hides all of its ad spots.
+func (s *Server) PatchCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := loadWith(w, r, "campaign", s.store.GetCampaign, CampaignNotFound)
+	if !ok {
+		return
+	}
+
+	var payload CampaignPayload
+	if !decodeMergePatch(w, r.Body, campaign.payload(), &payload) {
+		return
+	}
+
+	validationErrors := payload.validate()
+	if payload.AdvertiserID != nil && *payload.AdvertiserID != campaign.AdvertiserID {
+		validationErrors = append(validationErrors, "Advertiser ID field cannot be changed")
+	}
+	// The campaign always has a status, so only an explicit null removes it
+	if payload.Status == nil {
+		validationErrors = append(validationErrors, "Status field cannot be null")
+	}
+	if len(validationErrors) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Failed to validate JSON payload",
+			"context": validationErrors,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	if next := *payload.Status; next != campaign.Status && !campaign.Status.CanTransitionTo(next) {
+		JSONError(w, map[string]string{
+			"what":      "Illegal status transition",
+			"current":   campaign.Status.String(),
+			"requested": next.String(),
+		}, http.StatusConflict)
+		return
+	}
+
+	campaign.apply(payload)
+
+	if err := s.store.UpdateCampaign(r.Context(), campaign); err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database update",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	s.invalidate()
+
+	JSONResponse(w, campaign, http.StatusOK)
+}
+
+// DeleteCampaign removes a campaign, which must have no ad spots left.
+func (s *Server) DeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := loadWith(w, r, "campaign", s.store.GetCampaign, CampaignNotFound)
+	if !ok {
+		return
+	}
+
+	spots, err := s.store.List(r.Context(), AdSpotFilter{CampaignID: &campaign.ID})
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Database request failed",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	if len(spots) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Campaign still has ad spots",
+			"adSpots": len(spots),
+		}, http.StatusConflict)
+		return
+	}
+
+	if err := s.store.DeleteCampaign(r.Context(), campaign.ID); err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database update",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (gs *GormStore) CreateAdvertiser(ctx context.Context, advertiser Advertiser) error {
+	return gorm.G[Advertiser](gs.db).Create(ctx, &advertiser)
+}
+
+func (gs *GormStore) GetAdvertiser(ctx context.Context, id string) (Advertiser, error) {
+	return first[Advertiser](ctx, gs.db, id, AdvertiserNotFound)
+}
+
+func (gs *GormStore) ListAdvertisers(ctx context.Context) ([]Advertiser, error) {
+	return gorm.G[Advertiser](gs.db).Order("created_at desc, id desc").Find(ctx)
+}
+
+func (gs *GormStore) UpdateAdvertiser(ctx context.Context, advertiser Advertiser) error {
+	_, err := gorm.G[Advertiser](gs.db).Where("id = ?", advertiser.ID).Update(ctx, "name", advertiser.Name)
+	return err
+}
+
+func (gs *GormStore) DeleteAdvertiser(ctx context.Context, id string) error {
+	_, err := gorm.G[Advertiser](gs.db).Where("id = ?", id).Delete(ctx)
+	return err
+}
+
+func (gs *GormStore) CreateCampaign(ctx context.Context, campaign Campaign) error {
+	return gorm.G[Campaign](gs.db).Create(ctx, &campaign)
+}
+
+func (gs *GormStore) GetCampaign(ctx context.Context, id string) (Campaign, error) {
+	return first[Campaign](ctx, gs.db, id, CampaignNotFound)
+}
+
+func (gs *GormStore) ListCampaigns(ctx context.Context, filter CampaignFilter) ([]Campaign, error) {
+	query := gorm.G[Campaign](gs.db).Order("created_at desc, id desc")
+	if len(filter.IDs) > 0 {
+		query = query.Where("id IN ?", filter.IDs)
+	}
+	if filter.AdvertiserID != nil {
+		query = query.Where("advertiser_id = ?", *filter.AdvertiserID)
+	}
+	return query.Find(ctx)
+}
+
+func (gs *GormStore) UpdateCampaign(ctx context.Context, campaign Campaign) error {
+	_, err := gorm.G[Campaign](gs.db).
+		Where("id = ?", campaign.ID).
+		Select(campaignColumns[0], campaignColumns[1:]).
+		Updates(ctx, campaign)
+	return err
+}
+
+func (gs *GormStore) DeleteCampaign(ctx context.Context, id string) error {
+	_, err := gorm.G[Campaign](gs.db).Where("id = ?", id).Delete(ctx)
+	return err
+}
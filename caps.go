@@ -0,0 +1,174 @@
+package adspots
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// FrequencyCap limits how many impressions a single client may see within
+	// a sliding window.
+	FrequencyCap struct {
+		Count         int `json:"count"`
+		WindowMinutes int `json:"windowMinutes"`
+	}
+
+	// CapState reports how close an ad spot is to its impression caps. Client
+	// fields are only filled in when a client ID is given.
+	CapState struct {
+		Impressions       int64  `json:"impressions"`
+		Remaining         *int64 `json:"remaining,omitempty"`
+		Exhausted         bool   `json:"exhausted"`
+		ClientID          string `json:"clientId,omitempty"`
+		ClientImpressions *int   `json:"clientImpressions,omitempty"`
+		FrequencyCapped   bool   `json:"frequencyCapped"`
+	}
+)
+
+func (fc FrequencyCap) validate() []string {
+	var validationErrors []string
+	if fc.Count <= 0 {
+		validationErrors = append(validationErrors, "Frequency cap count must be positive")
+	}
+	if fc.WindowMinutes <= 0 {
+		validationErrors = append(validationErrors, "Frequency cap window must be positive")
+	}
+	return validationErrors
+}
+
+func (fc FrequencyCap) window() time.Duration {
+	return time.Duration(fc.WindowMinutes) * time.Minute
+}
+
+// capped reports whether the ad spot has any impression cap at all.
+func (a AdSpot) capped() bool {
+	return a.MaxImpressions != nil || a.FrequencyCap != nil
+}
+
+func (gs *GormStore) TotalImpressions(ctx context.Context, ids []string) (map[string]int64, error) {
+	var rows []struct {
+		AdSpotID    string
+		Impressions int64
+	}
+	err := gorm.G[EventRollup](gs.db).
+		Select("ad_spot_id, SUM(impressions) AS impressions").
+		Where("ad_spot_id IN ?", ids).
+		Group("ad_spot_id").
+		Scan(ctx, &rows)
+
+	totals := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		totals[row.AdSpotID] = row.Impressions
+	}
+	return totals, err
+}
+
+// clientImpressions counts the impressions the client has seen of each
+// frequency capped ad spot, within that ad spot's window.
+func (s *Server) clientImpressions(ctx context.Context, clientID string, spots []AdSpot, now time.Time) (map[string]int, error) {
+	var ids []string
+	var longest time.Duration
+	for _, spot := range spots {
+		if spot.FrequencyCap != nil {
+			ids = append(ids, spot.ID)
+			longest = max(longest, spot.FrequencyCap.window())
+		}
+	}
+
+	counts := make(map[string]int, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+
+	events, err := s.store.ClientImpressions(ctx, clientID, ids, now.Add(-longest))
+	if err != nil {
+		return nil, err
+	}
+
+	windows := make(map[string]time.Duration, len(ids))
+	for _, spot := range spots {
+		if spot.FrequencyCap != nil {
+			windows[spot.ID] = spot.FrequencyCap.window()
+		}
+	}
+	for _, event := range events {
+		if !time.Time(event.Timestamp).Before(now.Add(-windows[event.AdSpotID])) {
+			counts[event.AdSpotID]++
+		}
+	}
+	return counts, nil
+}
+
+// capStates computes the cap state of every capped ad spot. Frequency caps
+// can only be checked when the client is known.
+func (s *Server) capStates(ctx context.Context, spots []AdSpot, clientID string, now time.Time) (map[string]CapState, error) {
+	var ids []string
+	for _, spot := range spots {
+		if spot.capped() {
+			ids = append(ids, spot.ID)
+		}
+	}
+
+	states := make(map[string]CapState, len(ids))
+	if len(ids) == 0 {
+		return states, nil
+	}
+
+	totals, err := s.store.TotalImpressions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var perClient map[string]int
+	if clientID != "" {
+		perClient, err = s.clientImpressions(ctx, clientID, spots, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, spot := range spots {
+		if !spot.capped() {
+			continue
+		}
+
+		state := CapState{Impressions: totals[spot.ID]}
+		if spot.MaxImpressions != nil {
+			remaining := max(*spot.MaxImpressions-state.Impressions, 0)
+			state.Remaining = &remaining
+			state.Exhausted = remaining == 0
+		}
+		if spot.FrequencyCap != nil && clientID != "" {
+			seen := perClient[spot.ID]
+			state.ClientID = clientID
+			state.ClientImpressions = &seen
+			state.FrequencyCapped = seen >= spot.FrequencyCap.Count
+		}
+		states[spot.ID] = state
+	}
+	return states, nil
+}
+
+// withoutCapped drops the ad spots that reached one of their caps. Frequency
+// caps can't be checked without a client, so frequency capped ad spots are
+// dropped too when clientID is empty.
+func (s *Server) withoutCapped(ctx context.Context, spots []AdSpot, clientID string, now time.Time) ([]AdSpot, error) {
+	states, err := s.capStates(ctx, spots, clientID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(spots, func(a AdSpot) bool {
+		state := states[a.ID]
+		return state.Exhausted || state.FrequencyCapped || (a.FrequencyCap != nil && clientID == "")
+	}), nil
+}
+
+func (gs *GormStore) ClientImpressions(ctx context.Context, clientID string, ids []string, since time.Time) ([]Event, error) {
+	return gorm.G[Event](gs.db).
+		Where("client_id = ? AND type = ? AND ad_spot_id IN ? AND timestamp >= ?", clientID, EventImpression, ids, ISO8601(since.UTC())).
+		Find(ctx)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
@@ -10,20 +12,62 @@ import (
 	"syscall"
 	"time"
 
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
-
 	adspots "github.com/coyotoid/admoai-take-home-challenge"
 )
 
 func main() {
-	db, err := gorm.Open(sqlite.Open("adspots.db"), &gorm.Config{})
+	strategy := flag.String("strategy", "weighted", "ad selection strategy: weighted, random, round_robin or thompson")
+	seed := flag.Uint64("seed", 0, "seed for the thompson strategy, random if 0")
+	storage := flag.String("store", "gorm", "ad spot storage: gorm or sql")
+	driver := flag.String("db-driver", adspots.DriverSQLite, "database driver: sqlite or postgres")
+	dsn := flag.String("dsn", "adspots.db", "database file for sqlite, or connection string for postgres")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [migrate up|down|status]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	selector, err := adspots.ParseSelector(*strategy, *seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := adspots.OpenDatabase(*driver, *dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
-	db.AutoMigrate(&adspots.AdSpot{})
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flag.Arg(0) == "migrate" {
+		migrate(migrator, flag.Arg(1))
+		return
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if err := adspots.LoadPlacements(context.Background(), db); err != nil {
+		log.Fatal(err)
+	}
 
-	server := adspots.NewServer(db)
+	var store adspots.Store
+	switch *storage {
+	case "gorm":
+		store = adspots.NewGormStore(db)
+	case "sql":
+		sqlDB, err := db.DB()
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = adspots.WithAdSpots(adspots.NewGormStore(db), adspots.NewSQLStore(sqlDB, *driver))
+	default:
+		log.Fatalf("unknown store %q", *storage)
+	}
+
+	server := adspots.NewServer(store)
+	server.SetSelector(selector)
+	defer server.Close()
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -36,6 +80,13 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 	}
 
+	sweeper := adspots.NewSweeper(store, time.Minute)
+	sweeperDone := make(chan struct{})
+	go func() {
+		defer close(sweeperDone)
+		sweeper.Run(ctx)
+	}()
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			stop()
@@ -53,4 +104,45 @@ func main() {
 	if err := srv.Shutdown(timeout); err != nil {
 		log.Fatalln("error while shutting down:", err)
 	}
+	<-sweeperDone
+}
+
+// migrate runs the migrate subcommand, which changes or reports on the
+// database schema instead of serving.
+func migrate(migrator *adspots.Migrator, command string) {
+	ctx := context.Background()
+	switch command {
+	case "up":
+		ran, err := migrator.Up(ctx)
+		for _, migration := range ran {
+			log.Printf("applied %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(ran) == 0 {
+			log.Print("database is up to date")
+		}
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("reverted %04d_%s", migration.Version, migration.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 }
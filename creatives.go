@@ -0,0 +1,222 @@
+package adspots
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	// Creative is one variant of an ad spot, replacing its title and image
+	// when served. Variants are picked in proportion to their weight.
+	Creative struct {
+		ID       string `json:"id"`
+		Title    string `json:"title"`
+		ImageURL string `json:"imageUrl"`
+		Weight   int    `json:"weight"`
+	}
+	// CreativePayload is a creative as sent by clients. Its weight defaults
+	// to 1, like the weight of ad spots.
+	CreativePayload struct {
+		ID       string `json:"id"`
+		Title    string `json:"title"`
+		ImageURL string `json:"imageUrl"`
+		Weight   *int   `json:"weight"`
+	}
+
+	// CreativeRollup holds the number of events per creative and hour, like
+	// EventRollup does per ad spot.
+	CreativeRollup struct {
+		AdSpotID    string  `gorm:"primaryKey"`
+		CreativeID  string  `gorm:"primaryKey"`
+		Bucket      ISO8601 `gorm:"primaryKey"`
+		Impressions int64
+		Clicks      int64
+	}
+	CreativeStats struct {
+		CreativeID string `json:"creativeId"`
+		Counts
+	}
+)
+
+// MaxCreatives caps the number of variants of a single ad spot.
+const MaxCreatives = 10
+
+func validateCreatives(creatives []CreativePayload) []string {
+	var validationErrors []string
+	if len(creatives) > MaxCreatives {
+		validationErrors = append(validationErrors, fmt.Sprintf("Ad spots can have at most %d creatives", MaxCreatives))
+	}
+
+	seen := make(map[string]bool, len(creatives))
+	for i, creative := range creatives {
+		if creative.ID == "" || len(creative.ID) > 64 {
+			validationErrors = append(validationErrors, fmt.Sprintf("Creative %d must have an ID of at most 64 characters", i))
+		} else if seen[creative.ID] {
+			validationErrors = append(validationErrors, fmt.Sprintf("Creative %d reuses the ID %q", i, creative.ID))
+		}
+		seen[creative.ID] = true
+
+		if creative.Title == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("Creative %d must have a title", i))
+		}
+		if creative.ImageURL == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("Creative %d must have an image URL", i))
+		}
+		if creative.Weight != nil && (*creative.Weight < 1 || *creative.Weight > MaxWeight) {
+			validationErrors = append(validationErrors, fmt.Sprintf("Creative %d must have a weight between 1 and %d", i, MaxWeight))
+		}
+	}
+	return validationErrors
+}
+
+// creativesOf returns the creatives of a validated payload, with their
+// missing weights set.
+func creativesOf(payloads []CreativePayload) []Creative {
+	var creatives []Creative
+	for _, p := range payloads {
+		creative := Creative{ID: p.ID, Title: p.Title, ImageURL: p.ImageURL, Weight: 1}
+		if p.Weight != nil {
+			creative.Weight = *p.Weight
+		}
+		creatives = append(creatives, creative)
+	}
+	return creatives
+}
+
+// creativePayloads returns the creatives as clients would send them.
+func creativePayloads(creatives []Creative) []CreativePayload {
+	var payloads []CreativePayload
+	for _, c := range creatives {
+		payloads = append(payloads, CreativePayload{ID: c.ID, Title: c.Title, ImageURL: c.ImageURL, Weight: &c.Weight})
+	}
+	return payloads
+}
+
+// creativeFor picks the ad spot's creative for a client. The same client is
+// always assigned the same creative, as long as the creatives don't change.
+// Anonymous clients get a random one. ok is false if the ad spot has no
+// creatives.
+func (a AdSpot) creativeFor(clientID string) (creative Creative, ok bool) {
+	if len(a.Creatives) == 0 {
+		return creative, false
+	}
+
+	total := 0
+	for _, c := range a.Creatives {
+		total += c.Weight
+	}
+
+	var n int
+	if clientID == "" {
+		n = rand.IntN(total)
+	} else {
+		h := fnv.New64a()
+		h.Write([]byte(a.ID + "/" + clientID))
+		n = int(h.Sum64() % uint64(total))
+	}
+
+	for _, c := range a.Creatives {
+		n -= c.Weight
+		if n < 0 {
+			return c, true
+		}
+	}
+	return a.Creatives[len(a.Creatives)-1], true
+}
+
+// creative returns the ad spot's creative with the given ID.
+func (a AdSpot) creative(id string) (Creative, bool) {
+	i := slices.IndexFunc(a.Creatives, func(c Creative) bool { return c.ID == id })
+	if i < 0 {
+		return Creative{}, false
+	}
+	return a.Creatives[i], true
+}
+
+// withCreative returns the ad spot as shown to the client, with its title and
+// image replaced by those of its assigned creative.
+func (a AdSpot) withCreative(clientID string) AdSpot {
+	if creative, ok := a.creativeFor(clientID); ok {
+		a.Title = creative.Title
+		a.ImageURL = creative.ImageURL
+		a.CreativeID = creative.ID
+	}
+	return a
+}
+
+// rollupCreative adds a newly recorded event to its creative's hourly rollup.
+func rollupCreative(ctx context.Context, tx *gorm.DB, event Event) error {
+	rollup := CreativeRollup{
+		AdSpotID:   event.AdSpotID,
+		CreativeID: event.CreativeID,
+		Bucket:     rollupBucket(time.Time(event.Timestamp)),
+	}
+	switch event.Type {
+	case EventImpression:
+		rollup.Impressions = 1
+	case EventClick:
+		rollup.Clicks = 1
+	}
+
+	upsert := clause.OnConflict{
+		Columns: []clause.Column{{Name: "ad_spot_id"}, {Name: "creative_id"}, {Name: "bucket"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "impressions"}, Value: gorm.Expr("creative_rollups.impressions + excluded.impressions")},
+			{Column: clause.Column{Name: "clicks"}, Value: gorm.Expr("creative_rollups.clicks + excluded.clicks")},
+		},
+	}
+	return gorm.G[CreativeRollup](tx, upsert).Create(ctx, &rollup)
+}
+
+// creativeStats totals the events of each creative of the ad spot between
+// from and to. Current creatives are listed first, even without events,
+// followed by removed creatives that still have events in the range.
+func (s *Server) creativeStats(ctx context.Context, spot AdSpot, from, to time.Time) ([]CreativeStats, error) {
+	counts, err := s.store.CreativeCounts(ctx, spot.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]CreativeStats, 0, len(spot.Creatives))
+	for _, creative := range spot.Creatives {
+		stats = append(stats, CreativeStats{CreativeID: creative.ID})
+	}
+	for _, id := range slices.Sorted(maps.Keys(counts)) {
+		i := slices.IndexFunc(stats, func(c CreativeStats) bool { return c.CreativeID == id })
+		if i < 0 {
+			stats = append(stats, CreativeStats{CreativeID: id})
+			i = len(stats) - 1
+		}
+		stats[i].Counts = counts[id]
+	}
+	return stats, nil
+}
+
+func (gs *GormStore) CreativeCounts(ctx context.Context, id string, from, to time.Time) (map[string]Counts, error) {
+	var rows []struct {
+		CreativeID  string
+		Impressions int64
+		Clicks      int64
+	}
+	err := gorm.G[CreativeRollup](gs.db).
+		Select("creative_id, SUM(impressions) AS impressions, SUM(clicks) AS clicks").
+		Where("ad_spot_id = ? AND bucket >= ? AND bucket < ?", id, ISO8601(from), ISO8601(to)).
+		Group("creative_id").
+		Scan(ctx, &rows)
+
+	counts := make(map[string]Counts, len(rows))
+	for _, row := range rows {
+		var c Counts
+		c.add(row.Impressions, row.Clicks)
+		counts[row.CreativeID] = c
+	}
+	return counts, err
+}
@@ -0,0 +1,54 @@
+package adspots
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The supported database drivers. SQLite is given a file name, and Postgres a
+// connection string.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+var InvalidDriver = errors.New("invalid database driver")
+
+// OpenDatabase connects to the database with the named driver.
+func OpenDatabase(driver, dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case DriverSQLite:
+		dialector = sqlite.Open(dsn)
+	case DriverPostgres:
+		dialector = postgres.Open(dsn)
+	default:
+		return nil, InvalidDriver
+	}
+	return gorm.Open(dialector, &gorm.Config{})
+}
+
+// rebind rewrites the ? placeholders of a query into the driver's syntax.
+// Postgres numbers them instead.
+func rebind(driver, query string) string {
+	if driver != DriverPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
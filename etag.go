@@ -0,0 +1,103 @@
+package adspots
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag returns the entity tag of a response holding version of an ad spot:
+// the version, followed by a digest of the body. Cap states and the effective
+// status are computed when reading and change without a new version, so the
+// digest is what makes If-None-Match see them change.
+func etag(version int, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strconv.Quote(strconv.Itoa(version) + "-" + hex.EncodeToString(sum[:8]))
+}
+
+// etagVersion returns the ad spot version an entity tag was made for, or ""
+// for a weak or malformed tag.
+func etagVersion(tag string) string {
+	tag, err := strconv.Unquote(tag)
+	if err != nil {
+		return ""
+	}
+	version, _, _ := strings.Cut(tag, "-")
+	return version
+}
+
+// anyETag reports whether match holds for an entity tag in the lists of an
+// If-Match or If-None-Match header.
+func anyETag(header []string, match func(tag string) bool) bool {
+	for _, value := range header {
+		for tag := range strings.SplitSeq(value, ",") {
+			if match(strings.TrimSpace(tag)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeAdSpot answers with the ad spot and the entity tag of its body. For GET
+// requests whose If-None-Match header holds that tag, compared weakly, it
+// answers 304 Not Modified instead.
+func (s *Server) writeAdSpot(w http.ResponseWriter, r *http.Request, spot AdSpot) {
+	spots := []AdSpot{spot}
+	s.namePlacements(r.Context(), spots)
+	spot = spots[0]
+
+	body, err := json.Marshal(spot)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to encode ad spot",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	tag := etag(spot.Version, body)
+	w.Header().Set("ETag", tag)
+	notModified := anyETag(r.Header.Values("If-None-Match"), func(candidate string) bool {
+		return candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag
+	})
+	if r.Method == http.MethodGet && notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(body)
+}
+
+// checkIfMatch answers with 412 Precondition Failed if the request has an
+// If-Match header not matching the ad spot, in which case ok is false. Only
+// the version of the tags is compared, since writes don't depend on the
+// computed parts of the body, and weak tags never match.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, spot AdSpot) (ok bool) {
+	header := r.Header.Values("If-Match")
+	version := strconv.Itoa(spot.Version)
+	if len(header) == 0 || anyETag(header, func(tag string) bool { return tag == "*" || etagVersion(tag) == version }) {
+		return true
+	}
+
+	JSONError(w, map[string]any{
+		"what":    "Ad spot was changed since it was read",
+		"version": spot.Version,
+	}, http.StatusPreconditionFailed)
+	return false
+}
+
+// conflictStatus is the status code of a write that lost a race with
+// another one: 412 Precondition Failed if the client made it conditional with
+// If-Match, and 409 Conflict otherwise.
+func conflictStatus(r *http.Request) int {
+	if len(r.Header.Values("If-Match")) > 0 {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusConflict
+}
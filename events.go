@@ -0,0 +1,324 @@
+package adspots
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	EventType string
+
+	// Event is an impression or click reported by a client. Its ID is chosen
+	// by the client, so that retried reports are only counted once, and is
+	// only unique among the events of that client.
+	Event struct {
+		ID         string    `json:"eventId" gorm:"primaryKey"`
+		AdSpotID   string    `json:"adSpotId" gorm:"index"`
+		Type       EventType `json:"type"`
+		Placement  Placement `json:"placement"`
+		CampaignID *string   `json:"campaignId,omitempty"`
+		CreativeID string    `json:"creativeId,omitempty"`
+		ClientID   string    `json:"clientId" gorm:"primaryKey;index"`
+		Timestamp  ISO8601   `json:"timestamp" gorm:"index"`
+	}
+	EventPayload struct {
+		EventID    *string  `json:"eventId"`
+		ClientID   *string  `json:"clientId"`
+		Placement  *string  `json:"placement"`
+		CreativeID *string  `json:"creativeId"`
+		Timestamp  *ISO8601 `json:"timestamp"`
+	}
+	// BatchEventPayload is a single entry of POST /events, which also has to
+	// name the ad spot and the kind of event.
+	BatchEventPayload struct {
+		EventPayload
+		AdSpotID *string    `json:"adSpotId"`
+		Type     *EventType `json:"type"`
+	}
+	BatchPayload struct {
+		Events []BatchEventPayload `json:"events"`
+	}
+)
+
+// EventStore records events, and keeps their rollups and the spend of their
+// campaigns up to date.
+type EventStore interface {
+	// RecordEvents stores the events received at now, skipping those whose
+	// ID the client already used, adds them to their rollups and charges
+	// them to their campaign. It returns the events that were inserted.
+	RecordEvents(ctx context.Context, events []Event, now time.Time) ([]Event, error)
+	// TotalImpressions sums the impressions recorded for each of the ad
+	// spots. Ad spots without any are left out.
+	TotalImpressions(ctx context.Context, ids []string) (map[string]int64, error)
+	// ClientImpressions returns the impressions the client saw of the ad
+	// spots, timestamped since then.
+	ClientImpressions(ctx context.Context, clientID string, ids []string, since time.Time) ([]Event, error)
+	// AdSpotRollups returns the hourly rollups of the ad spot whose bucket
+	// starts between from and to, excluded.
+	AdSpotRollups(ctx context.Context, id string, from, to time.Time) ([]EventRollup, error)
+	// AdSpotCounts sums the events each of the ad spots received on the
+	// placement. Ad spots without any are left out.
+	AdSpotCounts(ctx context.Context, placement Placement, ids []string) (map[string]Counts, error)
+	// PlacementCounts sums the events of each placement whose hourly bucket
+	// starts between from and to, excluded.
+	PlacementCounts(ctx context.Context, from, to time.Time) (map[Placement]Counts, error)
+	// CreativeCounts sums the events of each creative of the ad spot whose
+	// hourly bucket starts between from and to, excluded.
+	CreativeCounts(ctx context.Context, id string, from, to time.Time) (map[string]Counts, error)
+}
+
+const (
+	EventImpression EventType = "impression"
+	EventClick      EventType = "click"
+)
+
+// MaxBatchSize caps the number of events accepted by POST /events at once.
+const MaxBatchSize = 500
+
+// MaxEventSkew bounds how far the timestamp of an event may be from the time
+// it is received, so that clients can't backdate or postdate their reports.
+const MaxEventSkew = 5 * time.Minute
+
+func (t EventType) valid() bool {
+	return t == EventImpression || t == EventClick
+}
+
+// validate checks the payload, filling in the event with the ad spot's
+// placement, and the current time if the client left it out. Clients may name
+// the placement, but it has to be the ad spot's.
+func (p EventPayload) validate(ctx context.Context, placements *placementRegistry, spot AdSpot, kind EventType, now time.Time) (Event, []string) {
+	var validationErrors []string
+	if p.EventID == nil || *p.EventID == "" {
+		validationErrors = append(validationErrors, "Event ID field cannot be missing")
+	}
+	if p.ClientID == nil || *p.ClientID == "" {
+		validationErrors = append(validationErrors, "Client ID field cannot be missing")
+	}
+
+	event := Event{
+		AdSpotID:   spot.ID,
+		Type:       kind,
+		Placement:  spot.Placement,
+		CampaignID: spot.CampaignID,
+		Timestamp:  ISO8601(now.UTC()),
+	}
+	if p.EventID != nil {
+		event.ID = *p.EventID
+	}
+	if p.ClientID != nil {
+		event.ClientID = *p.ClientID
+	}
+	if p.Placement != nil {
+		if id, ok := placements.lookup(ctx, *p.Placement); !ok {
+			validationErrors = append(validationErrors, "Invalid value for placement field")
+		} else if id != spot.Placement {
+			validationErrors = append(validationErrors, "Placement field doesn't match the ad spot's placement")
+		}
+	}
+	if p.CreativeID != nil {
+		if _, ok := spot.creative(*p.CreativeID); !ok {
+			validationErrors = append(validationErrors, "Invalid value for creative ID field")
+		}
+		event.CreativeID = *p.CreativeID
+	} else if creative, ok := spot.creativeFor(event.ClientID); ok && event.ClientID != "" {
+		// Clients that leave out the creative saw the one assigned to them
+		event.CreativeID = creative.ID
+	}
+	if p.Timestamp != nil {
+		timestamp := time.Time(*p.Timestamp)
+		if skew := timestamp.Sub(now).Abs(); skew > MaxEventSkew {
+			validationErrors = append(validationErrors, fmt.Sprintf("Timestamp field must be within %v of the current time", MaxEventSkew))
+		}
+		event.Timestamp = ISO8601(timestamp.UTC())
+	}
+
+	return event, validationErrors
+}
+
+func (s *Server) RecordImpression(w http.ResponseWriter, r *http.Request) {
+	s.recordEvent(w, r, EventImpression)
+}
+
+func (s *Server) RecordClick(w http.ResponseWriter, r *http.Request) {
+	s.recordEvent(w, r, EventClick)
+}
+
+// recordEvent answers with 201 Created when the event is new, and 200 OK
+// when it had already been recorded.
+func (s *Server) recordEvent(w http.ResponseWriter, r *http.Request, kind EventType) {
+	spot, ok := s.loadAdSpot(w, r)
+	if !ok {
+		return
+	}
+
+	var payload EventPayload
+	if !decodeStrict(w, r.Body, &payload) {
+		return
+	}
+
+	now := time.Now()
+	event, validationErrors := payload.validate(r.Context(), s.placements, spot, kind, now)
+	if len(validationErrors) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Failed to validate JSON payload",
+			"context": validationErrors,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	inserted, err := s.store.RecordEvents(r.Context(), []Event{event}, now)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to persist event",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	code := http.StatusCreated
+	if len(inserted) == 0 {
+		code = http.StatusOK
+	}
+	JSONResponse(w, map[string]any{
+		"eventId":   event.ID,
+		"duplicate": len(inserted) == 0,
+	}, code)
+}
+
+// RecordEvents ingests a batch of impressions and clicks. The batch is
+// rejected as a whole if any of its events is invalid.
+func (s *Server) RecordEvents(w http.ResponseWriter, r *http.Request) {
+	var payload BatchPayload
+	if !decodeStrict(w, r.Body, &payload) {
+		return
+	}
+
+	if len(payload.Events) == 0 || len(payload.Events) > MaxBatchSize {
+		JSONError(w, map[string]any{
+			"what":    "Invalid batch size",
+			"context": fmt.Sprintf("a batch must hold between 1 and %d events", MaxBatchSize),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	var ids []string
+	for _, entry := range payload.Events {
+		if entry.AdSpotID != nil && !slices.Contains(ids, *entry.AdSpotID) {
+			ids = append(ids, *entry.AdSpotID)
+		}
+	}
+
+	var spots []AdSpot
+	var err error
+	if len(ids) > 0 {
+		spots, err = s.store.List(r.Context(), AdSpotFilter{IDs: ids})
+	}
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Database request failed",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	byID := make(map[string]AdSpot, len(spots))
+	for _, spot := range spots {
+		byID[spot.ID] = spot
+	}
+
+	now := time.Now()
+	events := make([]Event, 0, len(payload.Events))
+	var validationErrors []string
+	for i, entry := range payload.Events {
+		var entryErrors []string
+		spot, found := AdSpot{}, false
+		if entry.AdSpotID == nil {
+			entryErrors = append(entryErrors, "Ad spot ID field cannot be missing")
+		} else if spot, found = byID[*entry.AdSpotID]; !found {
+			entryErrors = append(entryErrors, "Could not find ad spot with requested ID")
+		}
+		if entry.Type == nil || !entry.Type.valid() {
+			entryErrors = append(entryErrors, "Invalid value for type field")
+		}
+
+		var event Event
+		if found && len(entryErrors) == 0 {
+			event, entryErrors = entry.EventPayload.validate(r.Context(), s.placements, spot, *entry.Type, now)
+		}
+		for _, e := range entryErrors {
+			validationErrors = append(validationErrors, fmt.Sprintf("events[%d]: %s", i, e))
+		}
+		events = append(events, event)
+	}
+
+	if len(validationErrors) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Failed to validate JSON payload",
+			"context": validationErrors,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	inserted, err := s.store.RecordEvents(r.Context(), events, now)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to persist events",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	JSONResponse(w, map[string]int{
+		"accepted":   len(inserted),
+		"duplicates": len(events) - len(inserted),
+	}, http.StatusOK)
+}
+
+func (gs *GormStore) RecordEvents(ctx context.Context, events []Event, now time.Time) ([]Event, error) {
+	var inserted []Event
+	campaigns := make(map[string]Campaign)
+	err := gs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, event := range events {
+			result := gorm.WithResult()
+			if err := gorm.G[Event](tx, clause.OnConflict{DoNothing: true}, result).Create(ctx, &event); err != nil {
+				return err
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			if err := rollupEvent(ctx, tx, event); err != nil {
+				return err
+			}
+			if event.CreativeID != "" {
+				if err := rollupCreative(ctx, tx, event); err != nil {
+					return err
+				}
+			}
+			if event.CampaignID != nil {
+				campaign, ok := campaigns[*event.CampaignID]
+				if !ok {
+					found, err := gorm.G[Campaign](tx).Where("id = ?", *event.CampaignID).Find(ctx)
+					if err != nil {
+						return err
+					}
+					if len(found) > 0 {
+						campaign = found[0]
+					}
+					campaigns[*event.CampaignID] = campaign
+				}
+				if err := accrueSpend(ctx, tx, event, campaign, now); err != nil {
+					return err
+				}
+			}
+			inserted = append(inserted, event)
+		}
+		return nil
+	})
+	return inserted, err
+}
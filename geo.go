@@ -0,0 +1,306 @@
+package adspots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	GeoPoint struct {
+		Lat float64 `json:"lat"`
+		Lng float64 `json:"lng"`
+	}
+
+	// GeoTarget restricts an ad spot to an area, given either as a circle or
+	// as a GeoJSON polygon. Areas crossing the antimeridian aren't supported.
+	GeoTarget struct {
+		Center       *GeoPoint       `json:"center,omitempty"`
+		RadiusMeters *float64        `json:"radiusMeters,omitempty"`
+		Polygon      *GeoJSONPolygon `json:"polygon,omitempty"`
+	}
+
+	// GeoJSONPolygon follows RFC 7946: the first ring is the outer boundary,
+	// any others are holes, and positions are [longitude, latitude] pairs.
+	GeoJSONPolygon struct {
+		Type        string         `json:"type"`
+		Coordinates [][][2]float64 `json:"coordinates"`
+	}
+
+	// GeoBounds is the bounding box of a geo target, stored along with it so
+	// that ad spots can be filtered by point in SQL.
+	GeoBounds struct {
+		South float64
+		West  float64
+		North float64
+		East  float64
+	}
+
+	// geoIndex buckets the geo targeted ad spots that may be served into a
+	// grid of one degree cells, so that finding the areas containing a point
+	// only has to look at the few ad spots overlapping its cell. Its
+	// generation is bumped on every invalidation, so that a build racing
+	// with a write isn't kept.
+	geoIndex struct {
+		mu         sync.RWMutex
+		ttl        time.Duration
+		loadedAt   time.Time
+		cells      geoCells
+		generation uint64
+	}
+	geoCells map[geoCell][]geoEntry
+	geoCell  struct {
+		lat, lng int
+	}
+	geoEntry struct {
+		id     string
+		target GeoTarget
+	}
+)
+
+const (
+	earthRadiusMeters = 6371000
+	maxRadiusMeters   = 500000
+)
+
+var InvalidGeoPoint = errors.New("invalid geographic point")
+
+func (p GeoPoint) valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// distance returns the great-circle distance between two points in meters.
+func (p GeoPoint) distance(other GeoPoint) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, other.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (other.Lng - p.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// parseGeoPoint reads the lat and lng query parameters. The point is nil if
+// neither is given.
+func parseGeoPoint(r *http.Request) (*GeoPoint, error) {
+	lat, lng := r.URL.Query().Get("lat"), r.URL.Query().Get("lng")
+	if lat == "" && lng == "" {
+		return nil, nil
+	}
+
+	var p GeoPoint
+	var errLat, errLng error
+	p.Lat, errLat = strconv.ParseFloat(lat, 64)
+	p.Lng, errLng = strconv.ParseFloat(lng, 64)
+	if errLat != nil || errLng != nil || !p.valid() {
+		return nil, InvalidGeoPoint
+	}
+	return &p, nil
+}
+
+func (gt GeoTarget) validate() []string {
+	var validationErrors []string
+	circle := gt.Center != nil || gt.RadiusMeters != nil
+	if circle == (gt.Polygon != nil) {
+		return append(validationErrors, "Geo target must have either a center and radius, or a polygon")
+	}
+
+	if circle {
+		if gt.Center == nil || !gt.Center.valid() {
+			validationErrors = append(validationErrors, "Geo target center must be a valid point")
+		}
+		if gt.RadiusMeters == nil || *gt.RadiusMeters <= 0 || *gt.RadiusMeters > maxRadiusMeters {
+			validationErrors = append(validationErrors, fmt.Sprintf("Geo target radius must be positive and at most %d meters", maxRadiusMeters))
+		}
+		return validationErrors
+	}
+
+	if gt.Polygon.Type != "Polygon" {
+		validationErrors = append(validationErrors, `Geo target polygon must be a GeoJSON object of type "Polygon"`)
+	}
+	if len(gt.Polygon.Coordinates) == 0 {
+		validationErrors = append(validationErrors, "Geo target polygon must have an outer ring")
+	}
+	for i, ring := range gt.Polygon.Coordinates {
+		if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+			validationErrors = append(validationErrors, fmt.Sprintf("Geo target polygon ring %d must be closed and have at least 4 positions", i))
+		}
+		for _, position := range ring {
+			if !(GeoPoint{Lat: position[1], Lng: position[0]}).valid() {
+				validationErrors = append(validationErrors, fmt.Sprintf("Geo target polygon ring %d has an invalid position %v", i, position))
+				break
+			}
+		}
+	}
+	return validationErrors
+}
+
+// contains reports whether the point lies within the targeted area.
+func (gt GeoTarget) contains(p GeoPoint) bool {
+	if gt.Polygon == nil {
+		return gt.Center.distance(p) <= *gt.RadiusMeters
+	}
+
+	rings := gt.Polygon.Coordinates
+	if !ringContains(rings[0], p) {
+		return false
+	}
+	for _, hole := range rings[1:] {
+		if ringContains(hole, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains casts a ray from the point and counts the edges it crosses.
+func ringContains(ring [][2]float64, p GeoPoint) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > p.Lat) != (yj > p.Lat) && p.Lng < (xj-xi)*(p.Lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// bounds returns the south-west and north-east corners of the area.
+func (gt GeoTarget) bounds() (sw, ne GeoPoint) {
+	if gt.Polygon == nil {
+		dLat := *gt.RadiusMeters / earthRadiusMeters * 180 / math.Pi
+		dLng := 180.0
+		if cos := math.Cos(gt.Center.Lat * math.Pi / 180); cos > 0.01 {
+			dLng = math.Min(dLat/cos, 180)
+		}
+		sw = GeoPoint{Lat: math.Max(gt.Center.Lat-dLat, -90), Lng: math.Max(gt.Center.Lng-dLng, -180)}
+		ne = GeoPoint{Lat: math.Min(gt.Center.Lat+dLat, 90), Lng: math.Min(gt.Center.Lng+dLng, 180)}
+		return sw, ne
+	}
+
+	sw, ne = GeoPoint{Lat: 90, Lng: 180}, GeoPoint{Lat: -90, Lng: -180}
+	for _, position := range gt.Polygon.Coordinates[0] {
+		sw.Lng, sw.Lat = math.Min(sw.Lng, position[0]), math.Min(sw.Lat, position[1])
+		ne.Lng, ne.Lat = math.Max(ne.Lng, position[0]), math.Max(ne.Lat, position[1])
+	}
+	return sw, ne
+}
+
+// box returns the bounding box of the area, or nil without a geo target.
+func (gt *GeoTarget) box() *GeoBounds {
+	if gt == nil {
+		return nil
+	}
+	sw, ne := gt.bounds()
+	return &GeoBounds{South: sw.Lat, West: sw.Lng, North: ne.Lat, East: ne.Lng}
+}
+
+func cellOf(p GeoPoint) geoCell {
+	return geoCell{lat: int(math.Floor(p.Lat)), lng: int(math.Floor(p.Lng))}
+}
+
+func newGeoIndex(ttl time.Duration) *geoIndex {
+	return &geoIndex{ttl: ttl}
+}
+
+// build indexes the ad spots, which were loaded while the index was at the
+// given generation. The index only keeps them if it wasn't invalidated
+// meanwhile, since they may predate the write.
+func (gi *geoIndex) build(spots []AdSpot, generation uint64) geoCells {
+	cells := make(geoCells)
+	for _, spot := range spots {
+		if spot.Geo == nil {
+			continue
+		}
+
+		sw, ne := spot.Geo.bounds()
+		from, to := cellOf(sw), cellOf(ne)
+		for lat := from.lat; lat <= to.lat; lat++ {
+			for lng := from.lng; lng <= to.lng; lng++ {
+				cell := geoCell{lat: lat, lng: lng}
+				cells[cell] = append(cells[cell], geoEntry{id: spot.ID, target: *spot.Geo})
+			}
+		}
+	}
+
+	gi.mu.Lock()
+	if gi.generation == generation {
+		gi.cells = cells
+		gi.loadedAt = time.Now()
+	}
+	gi.mu.Unlock()
+	return cells
+}
+
+// matches returns the IDs of the ad spots whose area contains the point.
+func (cells geoCells) matches(p GeoPoint) map[string]bool {
+	ids := make(map[string]bool)
+	for _, entry := range cells[cellOf(p)] {
+		if entry.target.contains(p) {
+			ids[entry.id] = true
+		}
+	}
+	return ids
+}
+
+// lookup returns the IDs of the indexed ad spots whose area contains the
+// point, or ok set to false if the index needs to be rebuilt first, along
+// with the generation to build it for.
+func (gi *geoIndex) lookup(p GeoPoint) (ids map[string]bool, generation uint64, ok bool) {
+	gi.mu.RLock()
+	defer gi.mu.RUnlock()
+
+	if gi.cells == nil || time.Since(gi.loadedAt) >= gi.ttl {
+		return nil, gi.generation, false
+	}
+	return gi.cells.matches(p), gi.generation, true
+}
+
+// invalidate forces the index to be rebuilt on the next lookup.
+func (gi *geoIndex) invalidate() {
+	gi.mu.Lock()
+	gi.cells = nil
+	gi.generation++
+	gi.mu.Unlock()
+}
+
+// geoMatches returns the IDs of the geo targeted ad spots whose area contains
+// the point, rebuilding the index from the database when it is stale. Like
+// the candidates served, the index holds the active and scheduled ad spots.
+func (s *Server) geoMatches(ctx context.Context, p GeoPoint) (map[string]bool, error) {
+	ids, generation, ok := s.geo.lookup(p)
+	if ok {
+		return ids, nil
+	}
+
+	spots, err := s.store.List(ctx, AdSpotFilter{
+		GeoTargeted: true,
+		Effective:   []EffectiveStatus{EffectiveActive, EffectiveScheduled},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.geo.build(spots, generation).matches(p), nil
+}
+
+// withinGeo drops the geo targeted ad spots whose area doesn't contain the
+// point. Without a point, only the untargeted ad spots are kept.
+func (s *Server) withinGeo(ctx context.Context, spots []AdSpot, point *GeoPoint) ([]AdSpot, error) {
+	var matches map[string]bool
+	if point != nil {
+		var err error
+		if matches, err = s.geoMatches(ctx, *point); err != nil {
+			return nil, err
+		}
+	}
+
+	return slices.DeleteFunc(spots, func(a AdSpot) bool {
+		return a.Geo != nil && !matches[a.ID]
+	}), nil
+}
@@ -0,0 +1,225 @@
+package adspots
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyTTL is how long the response to a request sent with an
+// Idempotency-Key header is replayed to retries.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// idempotencyLockTTL bounds how long a request holds its key while being
+// handled, so that a process dying meanwhile doesn't block retries.
+const idempotencyLockTTL = time.Minute
+
+const maxIdempotencyKeyLength = 255
+
+// replayedHeaders are the response headers stored along with the body.
+var replayedHeaders = []string{"Content-Type", "ETag", "X-Content-Type-Options"}
+
+// IdempotencyRecord is the response to the first request sent with a key.
+type IdempotencyRecord struct {
+	Key         string `gorm:"primaryKey"`
+	Fingerprint string
+	// StatusCode is 0 while the first request is being handled.
+	StatusCode int
+	Header     map[string]string `gorm:"serializer:json"`
+	Body       []byte
+	CreatedAt  ISO8601 `gorm:"index"`
+}
+
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
+
+// IdempotencyStore persists the responses to requests sent with an
+// Idempotency-Key header.
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey stores the pending record, unless one is stored
+	// already for its key, in which case that one is returned and reserved
+	// is false. Records older than IdempotencyKeyTTL, and pending ones older
+	// than idempotencyLockTTL, are forgotten first.
+	ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, now time.Time) (stored IdempotencyRecord, reserved bool, err error)
+	// SaveIdempotentResponse stores the status code, header and body of the
+	// record under its key.
+	SaveIdempotentResponse(ctx context.Context, record IdempotencyRecord) error
+	// ReleaseIdempotencyKey forgets the record of the key.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
+
+// responseRecorder passes a response through, keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.code == 0 {
+		rr.code = code
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(buf []byte) (int, error) {
+	if rr.code == 0 {
+		rr.code = http.StatusOK
+	}
+	rr.body.Write(buf)
+	return rr.ResponseWriter.Write(buf)
+}
+
+// idempotent lets clients retry the handler safely by sending an
+// Idempotency-Key header. The first response to a key is stored along with a
+// fingerprint of its request, and replayed to retries. Reusing a key for a
+// different request answers 422 Unprocessable Entity, and retrying while the
+// first request is still handled answers 409 Conflict. Server errors aren't
+// stored, so that retries run again.
+func (s *Server) idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			handler(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			JSONError(w, map[string]string{
+				"what":    "Invalid value for Idempotency-Key header",
+				"context": fmt.Sprintf("keys must be at most %d characters long", maxIdempotencyKeyLength),
+			}, http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			JSONError(w, map[string]string{
+				"what":    "Failed to read request body",
+				"context": err.Error(),
+			}, http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+		pending := IdempotencyRecord{Key: key, Fingerprint: fingerprint, CreatedAt: ISO8601(time.Now())}
+		record, reserved, err := s.store.ReserveIdempotencyKey(r.Context(), pending, time.Now())
+		if err != nil {
+			JSONError(w, map[string]string{
+				"what":    "Database request failed",
+				"context": err.Error(),
+			}, http.StatusInternalServerError)
+			return
+		}
+
+		switch {
+		case reserved:
+			recorder := &responseRecorder{ResponseWriter: w}
+			handler(recorder, r)
+			// The response is sent already, so failing to store it only
+			// means retries will run again once the key expires
+			if err := s.saveIdempotentResponse(context.WithoutCancel(r.Context()), key, recorder); err != nil {
+				log.Print("error while storing idempotent response: ", err)
+			}
+		case record.Fingerprint != fingerprint:
+			JSONError(w, map[string]string{
+				"what": "Idempotency key was already used for a different request",
+				"key":  key,
+			}, http.StatusUnprocessableEntity)
+		case record.StatusCode == 0:
+			JSONError(w, map[string]string{
+				"what": "A request with this idempotency key is still being handled",
+				"key":  key,
+			}, http.StatusConflict)
+		default:
+			for name, value := range record.Header {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Body)
+		}
+	}
+}
+
+// requestFingerprint identifies a request by its method, URL and body. JSON
+// bodies are compared by value, ignoring formatting and the order of keys.
+func requestFingerprint(r *http.Request, body []byte) string {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var value any
+	if err := d.Decode(&value); err == nil && d.Decode(new(any)) == io.EOF {
+		if canonical, err := json.Marshal(value); err == nil {
+			body = canonical
+		}
+	}
+
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s %s\n%s", r.Method, r.URL.RequestURI(), body))
+	return hex.EncodeToString(sum[:])
+}
+
+// saveIdempotentResponse stores the recorded response for the key, or
+// releases the key if the request failed on the server's side.
+func (s *Server) saveIdempotentResponse(ctx context.Context, key string, recorder *responseRecorder) error {
+	code := cmp.Or(recorder.code, http.StatusOK)
+	if code >= http.StatusInternalServerError {
+		return s.store.ReleaseIdempotencyKey(ctx, key)
+	}
+
+	header := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if value := recorder.Header().Get(name); value != "" {
+			header[name] = value
+		}
+	}
+	return s.store.SaveIdempotentResponse(ctx, IdempotencyRecord{Key: key, StatusCode: code, Header: header, Body: recorder.body.Bytes()})
+}
+
+func (gs *GormStore) ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error) {
+	// Forget expired responses, and requests that were never answered
+	_, err := gorm.G[IdempotencyRecord](gs.db).
+		Where("created_at < ? OR (status_code = 0 AND created_at < ?)", ISO8601(now.Add(-IdempotencyKeyTTL)), ISO8601(now.Add(-idempotencyLockTTL))).
+		Delete(ctx)
+	if err != nil {
+		return record, false, err
+	}
+
+	result := gorm.WithResult()
+	if err := gorm.G[IdempotencyRecord](gs.db, clause.OnConflict{DoNothing: true}, result).Create(ctx, &record); err != nil {
+		return record, false, err
+	}
+	if result.RowsAffected > 0 {
+		return record, true, nil
+	}
+
+	records, err := gorm.G[IdempotencyRecord](gs.db).Where("key = ?", record.Key).Find(ctx)
+	if err != nil || len(records) == 0 {
+		return record, false, cmp.Or(err, gorm.ErrRecordNotFound)
+	}
+	return records[0], false, nil
+}
+
+func (gs *GormStore) SaveIdempotentResponse(ctx context.Context, record IdempotencyRecord) error {
+	_, err := gorm.G[IdempotencyRecord](gs.db).
+		Where("key = ?", record.Key).
+		Select("status_code", "header", "body").
+		Updates(ctx, record)
+	return err
+}
+
+func (gs *GormStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := gorm.G[IdempotencyRecord](gs.db).Where("key = ?", key).Delete(ctx)
+	return err
+}
@@ -0,0 +1,120 @@
+package adspots
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// statusTransitions lists, for every status, the statuses an ad spot may move
+// to next. Archived ad spots are kept for bookkeeping and can't be revived.
+var statusTransitions = map[Status][]Status{
+	StatusDraft:       {StatusActive, StatusArchived},
+	StatusActive:      {StatusPaused, StatusDeactivated},
+	StatusPaused:      {StatusActive, StatusDeactivated},
+	StatusDeactivated: {StatusActive, StatusArchived},
+	StatusArchived:    {},
+}
+
+// TransitionError is returned when an ad spot can't move between two statuses.
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e TransitionError) Error() string {
+	return fmt.Sprintf("cannot transition from %s to %s", e.From, e.To)
+}
+
+// CanTransitionTo reports whether the lifecycle allows moving from s to next.
+func (s Status) CanTransitionTo(next Status) bool {
+	return slices.Contains(statusTransitions[s], next)
+}
+
+// transition moves the ad spot to the next status, keeping DeactivatedAt in
+// sync with it.
+func (a *AdSpot) transition(next Status, now time.Time) error {
+	if !a.Status.CanTransitionTo(next) {
+		return TransitionError{From: a.Status, To: next}
+	}
+
+	a.Status = next
+	switch next {
+	case StatusDeactivated:
+		deactivatedAt := ISO8601(now)
+		a.DeactivatedAt = &deactivatedAt
+		a.DeactivationReason = DeactivationManual
+	case StatusActive:
+		a.DeactivatedAt = nil
+		a.DeactivationReason = ""
+	}
+	return nil
+}
+
+func (s *Server) ActivateAdSpot(w http.ResponseWriter, r *http.Request) {
+	s.transitionAdSpot(w, r, StatusActive)
+}
+
+func (s *Server) PauseAdSpot(w http.ResponseWriter, r *http.Request) {
+	s.transitionAdSpot(w, r, StatusPaused)
+}
+
+func (s *Server) DeactivateAdSpot(w http.ResponseWriter, r *http.Request) {
+	s.transitionAdSpot(w, r, StatusDeactivated)
+}
+
+func (s *Server) ArchiveAdSpot(w http.ResponseWriter, r *http.Request) {
+	s.transitionAdSpot(w, r, StatusArchived)
+}
+
+// transitionAdSpot moves the requested ad spot to the next status, answering
+// with 409 Conflict if the lifecycle doesn't allow it.
+func (s *Server) transitionAdSpot(w http.ResponseWriter, r *http.Request, next Status) {
+	spot, ok := s.loadAdSpot(w, r)
+	if !ok || !checkIfMatch(w, r, spot) {
+		return
+	}
+
+	current := spot.Status
+	if err := spot.transition(next, time.Now()); err != nil {
+		JSONError(w, map[string]string{
+			"what":      "Illegal status transition",
+			"current":   current.String(),
+			"requested": next.String(),
+		}, http.StatusConflict)
+		return
+	}
+
+	// Only update the row if nobody changed it since we read it
+	var updated bool
+	err := s.writeWithinLimit(r.Context(), spot, func(store AdSpotStore) (err error) {
+		updated, err = store.UpdateStatus(r.Context(), spot, current)
+		return err
+	})
+	if errors.Is(err, PlacementFull) {
+		placementFull(w, spot)
+		return
+	}
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database update",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	if !updated {
+		JSONError(w, map[string]string{
+			"what":      "Ad spot was changed concurrently",
+			"current":   current.String(),
+			"requested": next.String(),
+		}, conflictStatus(r))
+		return
+	}
+	s.invalidate()
+
+	spot.Version++
+	s.writeAdSpot(w, r, spot)
+}
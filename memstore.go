@@ -0,0 +1,659 @@
+package adspots
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps ad spots, and everything else a server keeps, in memory,
+// so that a server can run without a database. It is meant for tests, and
+// loses everything when the process exits.
+type MemoryStore struct {
+	mu              sync.RWMutex
+	spots           map[string]AdSpot
+	advertisers     map[string]Advertiser
+	campaigns       map[string]Campaign
+	spend           map[spendKey]int64
+	events          map[eventKey]Event
+	rollups         map[rollupKey]EventRollup
+	creativeRollups map[creativeRollupKey]CreativeRollup
+	placements      map[Placement]PlacementConfig
+	idempotency     map[string]IdempotencyRecord
+	// txMu runs transactions one at a time
+	txMu sync.Mutex
+}
+
+// The keys of the memory store's maps, which mirror the primary keys of the
+// SQL tables. Dates are in Unix seconds.
+type (
+	spendKey struct {
+		campaignID string
+		day        int64
+	}
+	eventKey struct {
+		clientID string
+		id       string
+	}
+	rollupKey struct {
+		adSpotID  string
+		placement Placement
+		bucket    int64
+	}
+	creativeRollupKey struct {
+		adSpotID   string
+		creativeID string
+		bucket     int64
+	}
+)
+
+// NewMemoryStore returns an empty store, which only knows the built-in
+// placements.
+func NewMemoryStore() *MemoryStore {
+	ms := &MemoryStore{
+		spots:           make(map[string]AdSpot),
+		advertisers:     make(map[string]Advertiser),
+		campaigns:       make(map[string]Campaign),
+		spend:           make(map[spendKey]int64),
+		events:          make(map[eventKey]Event),
+		rollups:         make(map[rollupKey]EventRollup),
+		creativeRollups: make(map[creativeRollupKey]CreativeRollup),
+		placements:      make(map[Placement]PlacementConfig),
+		idempotency:     make(map[string]IdempotencyRecord),
+	}
+	for _, placement := range builtinPlacements {
+		placement.CreatedAt = storedTime(ISO8601(time.Now()))
+		ms.placements[placement.ID] = placement
+	}
+	return ms
+}
+
+// storedTime returns the date as the SQL stores hold it, rounded down to the
+// second.
+func storedTime(tm ISO8601) ISO8601 {
+	return ISO8601(time.Time(tm).Truncate(time.Second).UTC())
+}
+
+// unix returns the date in Unix seconds, for map keys.
+func unix(tm ISO8601) int64 {
+	return time.Time(tm).Unix()
+}
+
+// inRange reports whether the date falls between from and to, excluded,
+// compared down to the second like the SQL stores do.
+func inRange(tm ISO8601, from, to time.Time) bool {
+	t := time.Time(tm)
+	return !t.Before(from.Truncate(time.Second)) && t.Before(to.Truncate(time.Second))
+}
+
+// stored returns a deep copy of the ad spot as the SQL stores would hold it:
+// without its response-only fields, and with its dates rounded to the second.
+func stored(spot AdSpot) (AdSpot, error) {
+	spot.CapState = nil
+	spot.CreativeID = ""
+	spot.ExpiresAt = spot.expiry()
+
+	buf, err := json.Marshal(spot)
+	if err != nil {
+		return AdSpot{}, err
+	}
+	var copied AdSpot
+	if err := json.Unmarshal(buf, &copied); err != nil {
+		return AdSpot{}, err
+	}
+	// The version is kept out of JSON, and the placement is only named
+	// there, so both have to be copied over
+	copied.Version = spot.Version
+	copied.Placement = spot.Placement
+	copied.placementName = ""
+	return copied, nil
+}
+
+func (ms *MemoryStore) Create(_ context.Context, spot AdSpot) error {
+	spot, err := stored(spot)
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.spots[spot.ID]; ok {
+		return fmt.Errorf("ad spot %s already exists", spot.ID)
+	}
+	spot.Version = 1
+	ms.spots[spot.ID] = spot
+	return nil
+}
+
+func (ms *MemoryStore) Get(_ context.Context, id string) (AdSpot, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	spot, ok := ms.spots[id]
+	if !ok {
+		return AdSpot{}, AdSpotNotFound
+	}
+	spot, err := stored(spot)
+	spot.CampaignInactive = ms.campaignInactive(spot)
+	return spot, err
+}
+
+// campaignInactive reports whether the ad spot's campaign isn't active. The
+// caller must hold the lock.
+func (ms *MemoryStore) campaignInactive(spot AdSpot) bool {
+	if spot.CampaignID == nil {
+		return false
+	}
+	campaign, ok := ms.campaigns[*spot.CampaignID]
+	return ok && campaign.Status != StatusActive
+}
+
+func (ms *MemoryStore) Update(_ context.Context, spot AdSpot) error {
+	spot, err := stored(spot)
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	current, ok := ms.spots[spot.ID]
+	if !ok {
+		return AdSpotNotFound
+	}
+	if current.Version != spot.Version {
+		return StaleAdSpot
+	}
+	spot.Version++
+	spot.Status = current.Status
+	spot.CreatedAt = current.CreatedAt
+	spot.DeactivatedAt = current.DeactivatedAt
+	spot.DeactivationReason = current.DeactivationReason
+	ms.spots[spot.ID] = spot
+	return nil
+}
+
+func (ms *MemoryStore) UpdateStatus(_ context.Context, spot AdSpot, from Status) (bool, error) {
+	spot, err := stored(spot)
+	if err != nil {
+		return false, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	current, ok := ms.spots[spot.ID]
+	if !ok || current.Status != from || current.Version != spot.Version {
+		return false, nil
+	}
+	current.Version++
+	current.Status = spot.Status
+	current.DeactivatedAt = spot.DeactivatedAt
+	current.DeactivationReason = spot.DeactivationReason
+	ms.spots[spot.ID] = current
+	return true, nil
+}
+
+func (ms *MemoryStore) List(_ context.Context, filter AdSpotFilter) ([]AdSpot, error) {
+	ms.mu.RLock()
+	var spots []AdSpot
+	for _, spot := range ms.spots {
+		spot.CampaignInactive = ms.campaignInactive(spot)
+		if filter.matches(spot) {
+			spots = append(spots, spot)
+		}
+	}
+	ms.mu.RUnlock()
+
+	slices.SortFunc(spots, compareAdSpots(filter.Sort))
+	if filter.Limit > 0 && len(spots) > filter.Limit {
+		spots = spots[:filter.Limit]
+	}
+	for i := range spots {
+		var err error
+		inactive := spots[i].CampaignInactive
+		if spots[i], err = stored(spots[i]); err != nil {
+			return nil, err
+		}
+		spots[i].CampaignInactive = inactive
+	}
+	return spots, nil
+}
+
+func (ms *MemoryStore) DeactivateExpired(_ context.Context, now time.Time) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	deactivated := 0
+	for id, spot := range ms.spots {
+		if spot.Status != StatusActive && spot.Status != StatusPaused {
+			continue
+		}
+		if spot.ExpiresAt == nil || !time.Time(*spot.ExpiresAt).Before(now.Truncate(time.Second)) {
+			continue
+		}
+		spot.Status = StatusDeactivated
+		spot.DeactivatedAt = spot.ExpiresAt
+		spot.DeactivationReason = DeactivationTTLExpired
+		spot.Version++
+		ms.spots[id] = spot
+		deactivated++
+	}
+	return deactivated, nil
+}
+
+// matches reports whether the ad spot passes the filter, like the SQL
+// condition returned by conditions. Dates are compared down to the second,
+// as stored.
+func (f AdSpotFilter) matches(spot AdSpot) bool {
+	switch {
+	case len(f.IDs) > 0 && !slices.Contains(f.IDs, spot.ID):
+		return false
+	case f.Placement != nil && spot.Placement != *f.Placement:
+		return false
+	case f.CampaignID != nil && (spot.CampaignID == nil || *spot.CampaignID != *f.CampaignID):
+		return false
+	case f.Status != nil && spot.Status != *f.Status:
+		return false
+	case len(f.Effective) > 0 && !slices.Contains(f.Effective, spot.ownStatusAt(f.now().Truncate(time.Second))):
+		return false
+	case f.ActiveCampaigns && spot.CampaignInactive:
+		return false
+	case f.GeoTargeted && spot.Geo == nil:
+		return false
+	case f.GeoPoint != nil && spot.Geo != nil && !spot.Geo.contains(*f.GeoPoint):
+		return false
+	case f.After != nil && !f.After.precedes(spot):
+		return false
+	}
+	return true
+}
+
+// Transaction runs fn once every other transaction is done. Writes made before
+// fn fails aren't rolled back, so fn should write last.
+func (ms *MemoryStore) Transaction(_ context.Context, _ Placement, fn func(AdSpotStore) error) error {
+	ms.txMu.Lock()
+	defer ms.txMu.Unlock()
+	return fn(ms)
+}
+
+func (ms *MemoryStore) CreateAdvertiser(_ context.Context, advertiser Advertiser) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.advertisers[advertiser.ID]; ok {
+		return fmt.Errorf("advertiser %s already exists", advertiser.ID)
+	}
+	advertiser.CreatedAt = storedTime(advertiser.CreatedAt)
+	ms.advertisers[advertiser.ID] = advertiser
+	return nil
+}
+
+func (ms *MemoryStore) GetAdvertiser(_ context.Context, id string) (Advertiser, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	advertiser, ok := ms.advertisers[id]
+	if !ok {
+		return Advertiser{}, AdvertiserNotFound
+	}
+	return advertiser, nil
+}
+
+func (ms *MemoryStore) ListAdvertisers(_ context.Context) ([]Advertiser, error) {
+	ms.mu.RLock()
+	advertisers := slices.Collect(maps.Values(ms.advertisers))
+	ms.mu.RUnlock()
+
+	slices.SortFunc(advertisers, func(a, b Advertiser) int {
+		return newestFirst(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+	return advertisers, nil
+}
+
+func (ms *MemoryStore) UpdateAdvertiser(_ context.Context, advertiser Advertiser) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if current, ok := ms.advertisers[advertiser.ID]; ok {
+		current.Name = advertiser.Name
+		ms.advertisers[advertiser.ID] = current
+	}
+	return nil
+}
+
+func (ms *MemoryStore) DeleteAdvertiser(_ context.Context, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.advertisers, id)
+	return nil
+}
+
+// storedCampaign returns a copy of the campaign as the SQL stores would hold
+// it, without its budget state.
+func storedCampaign(campaign Campaign) Campaign {
+	campaign.CreatedAt = storedTime(campaign.CreatedAt)
+	campaign.DailyBudgetMicros = clonePointer(campaign.DailyBudgetMicros)
+	campaign.LifetimeBudgetMicros = clonePointer(campaign.LifetimeBudgetMicros)
+	campaign.Pricing = clonePointer(campaign.Pricing)
+	campaign.Pacing = cmp.Or(campaign.Pacing, PacingEven)
+	campaign.Budget = nil
+	return campaign
+}
+
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func (ms *MemoryStore) CreateCampaign(_ context.Context, campaign Campaign) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.campaigns[campaign.ID]; ok {
+		return fmt.Errorf("campaign %s already exists", campaign.ID)
+	}
+	ms.campaigns[campaign.ID] = storedCampaign(campaign)
+	return nil
+}
+
+func (ms *MemoryStore) GetCampaign(_ context.Context, id string) (Campaign, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	campaign, ok := ms.campaigns[id]
+	if !ok {
+		return Campaign{}, CampaignNotFound
+	}
+	return storedCampaign(campaign), nil
+}
+
+func (ms *MemoryStore) ListCampaigns(_ context.Context, filter CampaignFilter) ([]Campaign, error) {
+	ms.mu.RLock()
+	var campaigns []Campaign
+	for _, campaign := range ms.campaigns {
+		switch {
+		case len(filter.IDs) > 0 && !slices.Contains(filter.IDs, campaign.ID):
+		case filter.AdvertiserID != nil && campaign.AdvertiserID != *filter.AdvertiserID:
+		default:
+			campaigns = append(campaigns, storedCampaign(campaign))
+		}
+	}
+	ms.mu.RUnlock()
+
+	slices.SortFunc(campaigns, func(a, b Campaign) int {
+		return newestFirst(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+	return campaigns, nil
+}
+
+// newestFirst orders rows by creation date then ID, both descending.
+func newestFirst(aCreated ISO8601, aID string, bCreated ISO8601, bID string) int {
+	return cmp.Or(time.Time(bCreated).Compare(time.Time(aCreated)), cmp.Compare(bID, aID))
+}
+
+func (ms *MemoryStore) UpdateCampaign(_ context.Context, campaign Campaign) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	current, ok := ms.campaigns[campaign.ID]
+	if !ok {
+		return nil
+	}
+	updated := storedCampaign(campaign)
+	current.Name = updated.Name
+	current.Status = updated.Status
+	current.DailyBudgetMicros = updated.DailyBudgetMicros
+	current.LifetimeBudgetMicros = updated.LifetimeBudgetMicros
+	current.Pricing = updated.Pricing
+	current.RateMicros = updated.RateMicros
+	current.Pacing = updated.Pacing
+	ms.campaigns[campaign.ID] = current
+	return nil
+}
+
+func (ms *MemoryStore) DeleteCampaign(_ context.Context, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.campaigns, id)
+	return nil
+}
+
+func (ms *MemoryStore) CampaignSpend(_ context.Context, ids []string, now time.Time) (map[string]BudgetState, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	spent := make(map[string]BudgetState)
+	today := unix(spendDay(now))
+	for key, nanos := range ms.spend {
+		if !slices.Contains(ids, key.campaignID) {
+			continue
+		}
+		state := spent[key.campaignID]
+		state.LifetimeMicros += nanos / 1000
+		if key.day == today {
+			state.TodayMicros += nanos / 1000
+		}
+		spent[key.campaignID] = state
+	}
+	return spent, nil
+}
+
+func (ms *MemoryStore) RecordEvents(_ context.Context, events []Event, now time.Time) ([]Event, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var inserted []Event
+	for _, event := range events {
+		id := eventKey{clientID: event.ClientID, id: event.ID}
+		if _, ok := ms.events[id]; ok {
+			continue
+		}
+		stored := event
+		stored.Timestamp = storedTime(event.Timestamp)
+		stored.CampaignID = clonePointer(event.CampaignID)
+		ms.events[id] = stored
+
+		bucket := rollupBucket(time.Time(event.Timestamp))
+		key := rollupKey{adSpotID: event.AdSpotID, placement: event.Placement, bucket: unix(bucket)}
+		rollup := ms.rollups[key]
+		rollup.AdSpotID, rollup.Placement, rollup.Bucket = event.AdSpotID, event.Placement, bucket
+		rollup.Impressions, rollup.Clicks = countEvent(event, rollup.Impressions, rollup.Clicks)
+		ms.rollups[key] = rollup
+
+		if event.CreativeID != "" {
+			key := creativeRollupKey{adSpotID: event.AdSpotID, creativeID: event.CreativeID, bucket: unix(bucket)}
+			rollup := ms.creativeRollups[key]
+			rollup.AdSpotID, rollup.CreativeID, rollup.Bucket = event.AdSpotID, event.CreativeID, bucket
+			rollup.Impressions, rollup.Clicks = countEvent(event, rollup.Impressions, rollup.Clicks)
+			ms.creativeRollups[key] = rollup
+		}
+
+		if event.CampaignID != nil {
+			if cost := ms.campaigns[*event.CampaignID].cost(event.Type); cost > 0 {
+				ms.spend[spendKey{campaignID: *event.CampaignID, day: unix(spendDay(now))}] += cost
+			}
+		}
+		inserted = append(inserted, event)
+	}
+	return inserted, nil
+}
+
+// countEvent adds the event to the impressions or clicks of a rollup.
+func countEvent(event Event, impressions, clicks int64) (int64, int64) {
+	switch event.Type {
+	case EventImpression:
+		impressions++
+	case EventClick:
+		clicks++
+	}
+	return impressions, clicks
+}
+
+func (ms *MemoryStore) TotalImpressions(_ context.Context, ids []string) (map[string]int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	totals := make(map[string]int64)
+	for key, rollup := range ms.rollups {
+		if slices.Contains(ids, key.adSpotID) {
+			totals[key.adSpotID] += rollup.Impressions
+		}
+	}
+	return totals, nil
+}
+
+func (ms *MemoryStore) ClientImpressions(_ context.Context, clientID string, ids []string, since time.Time) ([]Event, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	var events []Event
+	for key, event := range ms.events {
+		if key.clientID == clientID && event.Type == EventImpression && slices.Contains(ids, event.AdSpotID) &&
+			!time.Time(event.Timestamp).Before(since.Truncate(time.Second)) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (ms *MemoryStore) AdSpotRollups(_ context.Context, id string, from, to time.Time) ([]EventRollup, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	var rollups []EventRollup
+	for key, rollup := range ms.rollups {
+		if key.adSpotID == id && inRange(rollup.Bucket, from, to) {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups, nil
+}
+
+func (ms *MemoryStore) AdSpotCounts(_ context.Context, placement Placement, ids []string) (map[string]Counts, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	stats := make(map[string]Counts)
+	for key, rollup := range ms.rollups {
+		if key.placement == placement && slices.Contains(ids, key.adSpotID) {
+			counts := stats[key.adSpotID]
+			counts.add(rollup.Impressions, rollup.Clicks)
+			stats[key.adSpotID] = counts
+		}
+	}
+	return stats, nil
+}
+
+func (ms *MemoryStore) PlacementCounts(_ context.Context, from, to time.Time) (map[Placement]Counts, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	stats := make(map[Placement]Counts)
+	for key, rollup := range ms.rollups {
+		if inRange(rollup.Bucket, from, to) {
+			counts := stats[key.placement]
+			counts.add(rollup.Impressions, rollup.Clicks)
+			stats[key.placement] = counts
+		}
+	}
+	return stats, nil
+}
+
+func (ms *MemoryStore) CreativeCounts(_ context.Context, id string, from, to time.Time) (map[string]Counts, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	stats := make(map[string]Counts)
+	for key, rollup := range ms.creativeRollups {
+		if key.adSpotID == id && inRange(rollup.Bucket, from, to) {
+			counts := stats[key.creativeID]
+			counts.add(rollup.Impressions, rollup.Clicks)
+			stats[key.creativeID] = counts
+		}
+	}
+	return stats, nil
+}
+
+// storedPlacement returns a copy of the placement, with its date rounded
+// down to the second.
+func storedPlacement(config PlacementConfig) PlacementConfig {
+	config.AllowedDimensions = slices.Clone(config.AllowedDimensions)
+	config.MaxActiveAds = clonePointer(config.MaxActiveAds)
+	config.CreatedAt = storedTime(config.CreatedAt)
+	return config
+}
+
+func (ms *MemoryStore) ListPlacements(_ context.Context) ([]PlacementConfig, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	var configs []PlacementConfig
+	for _, id := range slices.Sorted(maps.Keys(ms.placements)) {
+		configs = append(configs, storedPlacement(ms.placements[id]))
+	}
+	return configs, nil
+}
+
+func (ms *MemoryStore) GetPlacement(_ context.Context, id Placement) (PlacementConfig, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	config, ok := ms.placements[id]
+	if !ok {
+		return PlacementConfig{}, nil
+	}
+	return storedPlacement(config), nil
+}
+
+func (ms *MemoryStore) CreatePlacement(_ context.Context, config *PlacementConfig) (nameTaken bool, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, stored := range ms.placements {
+		if stored.Name == config.Name {
+			return true, nil
+		}
+	}
+	config.ID = nextPlacementID(slices.Max(slices.Collect(maps.Keys(ms.placements))))
+	ms.placements[config.ID] = storedPlacement(*config)
+	return false, nil
+}
+
+// storedRecord returns a copy of the idempotency record, with its date
+// rounded down to the second.
+func storedRecord(record IdempotencyRecord) IdempotencyRecord {
+	record.Header = maps.Clone(record.Header)
+	record.Body = slices.Clone(record.Body)
+	record.CreatedAt = storedTime(record.CreatedAt)
+	return record
+}
+
+func (ms *MemoryStore) ReserveIdempotencyKey(_ context.Context, record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// Forget expired responses, and requests that were never answered
+	expired := now.Add(-IdempotencyKeyTTL).Truncate(time.Second)
+	abandoned := now.Add(-idempotencyLockTTL).Truncate(time.Second)
+	maps.DeleteFunc(ms.idempotency, func(_ string, stored IdempotencyRecord) bool {
+		created := time.Time(stored.CreatedAt)
+		return created.Before(expired) || (stored.StatusCode == 0 && created.Before(abandoned))
+	})
+
+	if stored, ok := ms.idempotency[record.Key]; ok {
+		return storedRecord(stored), false, nil
+	}
+	ms.idempotency[record.Key] = storedRecord(record)
+	return record, true, nil
+}
+
+func (ms *MemoryStore) SaveIdempotentResponse(_ context.Context, record IdempotencyRecord) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	stored, ok := ms.idempotency[record.Key]
+	if !ok {
+		return nil
+	}
+	saved := storedRecord(record)
+	stored.StatusCode, stored.Header, stored.Body = saved.StatusCode, saved.Header, saved.Body
+	ms.idempotency[record.Key] = stored
+	return nil
+}
+
+func (ms *MemoryStore) ReleaseIdempotencyKey(_ context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.idempotency, key)
+	return nil
+}
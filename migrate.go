@@ -0,0 +1,250 @@
+package adspots
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds the schema of every driver, as numbered pairs of
+// scripts such as migrations/sqlite/0001_initial.up.sql and its .down.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var UnmigratedDatabase = errors.New("database schema is out of date, run: adspots migrate up")
+var UnknownMigration = errors.New("database has migrations this version does not know about")
+var NoAppliedMigrations = errors.New("no migrations have been applied")
+
+// Migration is a versioned change to the schema, and the script undoing it.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus tells whether a migration has been applied, and when.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// schemaMigration records an applied migration in the schema_migrations table.
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies the embedded migrations of the database's driver, in
+// order of their versions. Each one runs in a transaction along with its
+// record in schema_migrations.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	dir := path.Join("migrations", db.Dialector.Name())
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, InvalidDriver
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".sql")
+		if !ok {
+			continue
+		}
+		base, direction, _ := strings.Cut(base, ".")
+		number, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file %s", entry.Name())
+		}
+
+		script, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	migrator := &Migrator{db: db}
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down script", m.Version, m.Name)
+		}
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+	slices.SortFunc(migrator.migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+	return migrator, nil
+}
+
+// Migrations lists the known migrations, oldest first.
+func (m *Migrator) Migrations() []Migration {
+	return slices.Clone(m.migrations)
+}
+
+// applied returns the recorded migrations, oldest first. A database without
+// a schema_migrations table has none.
+func (m *Migrator) applied(ctx context.Context) ([]schemaMigration, error) {
+	if !m.db.Migrator().HasTable(schemaMigration{}) {
+		return nil, nil
+	}
+	return gorm.G[schemaMigration](m.db).Order("version").Find(ctx)
+}
+
+// Up applies every pending migration, and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	err := m.db.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version bigint PRIMARY KEY, name text NOT NULL, applied_at timestamp NOT NULL)`).Error
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]bool, len(applied))
+	for _, record := range applied {
+		done[record.Version] = true
+	}
+
+	var ran []Migration
+	for _, migration := range m.migrations {
+		if done[migration.Version] {
+			continue
+		}
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, migration.up); err != nil {
+				return err
+			}
+			record := schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}
+			return gorm.G[schemaMigration](tx).Create(ctx, &record)
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// execScript runs a migration script. Scripts made only of comments, such as
+// those of migrations that can't be undone, are skipped, since some drivers
+// reject empty statements.
+func execScript(tx *gorm.DB, script string) error {
+	for line := range strings.Lines(script) {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return tx.Exec(script).Error
+		}
+	}
+	return nil
+}
+
+// Down reverts the most recently applied migration, and returns it.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	if len(applied) == 0 {
+		return Migration{}, NoAppliedMigrations
+	}
+
+	latest := applied[len(applied)-1]
+	i := slices.IndexFunc(m.migrations, func(migration Migration) bool {
+		return migration.Version == latest.Version
+	})
+	if i < 0 {
+		return Migration{}, UnknownMigration
+	}
+	migration := m.migrations[i]
+
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := execScript(tx, migration.down); err != nil {
+			return err
+		}
+		_, err := gorm.G[schemaMigration](tx).Where("version = ?", migration.Version).Delete(ctx)
+		return err
+	})
+	if err != nil {
+		return Migration{}, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return migration, nil
+}
+
+// Status lists every known migration along with when it was applied, followed
+// by any applied migration this version does not know about.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]schemaMigration, len(applied))
+	for _, record := range applied {
+		appliedAt[record.Version] = record
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+			delete(appliedAt, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		if _, ok := appliedAt[record.Version]; ok {
+			statuses = append(statuses, MigrationStatus{Version: record.Version, Name: record.Name, AppliedAt: &record.AppliedAt})
+		}
+	}
+	return statuses, nil
+}
+
+// Check fails unless every known migration has been applied, and no others.
+// The server refuses to start against a database that fails it.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for i, status := range statuses {
+		if i >= len(m.migrations) {
+			return UnknownMigration
+		}
+		if status.AppliedAt == nil {
+			return UnmigratedDatabase
+		}
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+-- The schema of the first release, which db.AutoMigrate created. Postgres was
+-- only supported once statuses were named, so the status is text rather than
+-- the boolean of that release.
+CREATE TABLE IF NOT EXISTS "ad_spots" ("id" text,"title" text,"image_url" text,"placement" bigint,"status" text,"ttl_minutes" bigint,"created_at" timestamptz,"deactivated_at" timestamptz,PRIMARY KEY ("id"));
@@ -0,0 +1,20 @@
+-- Lifecycles, campaigns, priorities, caps, flights, schedules and targeting
+-- of ad spots. Columns are only added if missing, so that databases set up by
+-- db.AutoMigrate when Postgres was first supported can adopt migrations.
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "campaign_id" text;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "priority" bigint;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "weight" bigint DEFAULT 1;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "deactivation_reason" text;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "expires_at" timestamptz;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "max_impressions" bigint;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "frequency_cap" text;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "start_at" timestamptz;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "end_at" timestamptz;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "schedule" text;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "geo" text;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "targeting" text;
+ALTER TABLE "ad_spots" ADD COLUMN IF NOT EXISTS "creatives" text;
+CREATE INDEX IF NOT EXISTS "idx_ad_spots_start_at" ON "ad_spots" ("start_at");
+CREATE INDEX IF NOT EXISTS "idx_ad_spots_expires_at" ON "ad_spots" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_ad_spots_priority" ON "ad_spots" ("priority");
+CREATE INDEX IF NOT EXISTS "idx_ad_spots_campaign_id" ON "ad_spots" ("campaign_id");
@@ -0,0 +1,3 @@
+DROP TABLE "creative_rollups";
+DROP TABLE "event_rollups";
+DROP TABLE "events";
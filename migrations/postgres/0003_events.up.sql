@@ -0,0 +1,9 @@
+-- Impressions and clicks, and their hourly counts per ad spot and creative.
+CREATE TABLE IF NOT EXISTS "events" ("id" text,"ad_spot_id" text,"type" text,"placement" bigint,"campaign_id" text,"creative_id" text,"client_id" text,"timestamp" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_events_timestamp" ON "events" ("timestamp");
+CREATE INDEX IF NOT EXISTS "idx_events_client_id" ON "events" ("client_id");
+CREATE INDEX IF NOT EXISTS "idx_events_ad_spot_id" ON "events" ("ad_spot_id");
+
+CREATE TABLE IF NOT EXISTS "event_rollups" ("ad_spot_id" text,"placement" bigint,"bucket" timestamptz,"impressions" bigint,"clicks" bigint,PRIMARY KEY ("ad_spot_id","placement","bucket"));
+
+CREATE TABLE IF NOT EXISTS "creative_rollups" ("ad_spot_id" text,"creative_id" text,"bucket" timestamptz,"impressions" bigint,"clicks" bigint,PRIMARY KEY ("ad_spot_id","creative_id","bucket"));
@@ -0,0 +1,3 @@
+DROP TABLE "campaign_spends";
+DROP TABLE "campaigns";
+DROP TABLE "advertisers";
@@ -0,0 +1,7 @@
+-- Advertisers, their campaigns, and the daily spend of each campaign.
+CREATE TABLE IF NOT EXISTS "advertisers" ("id" text,"name" text,"created_at" timestamptz,PRIMARY KEY ("id"));
+
+CREATE TABLE IF NOT EXISTS "campaigns" ("id" text,"advertiser_id" text,"name" text,"status" text,"created_at" timestamptz,"daily_budget_micros" bigint,"lifetime_budget_micros" bigint,"pricing" bigint,"rate_micros" bigint,"pacing" bigint DEFAULT 1,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_campaigns_advertiser_id" ON "campaigns" ("advertiser_id");
+
+CREATE TABLE IF NOT EXISTS "campaign_spends" ("campaign_id" text,"day" timestamptz,"spend_micros" bigint,PRIMARY KEY ("campaign_id","day"));
@@ -0,0 +1,4 @@
+-- Placements, which used to be built in. The built-in ones are stored when
+-- the server starts.
+CREATE TABLE IF NOT EXISTS "placements" ("id" bigint,"name" text,"description" text,"allowed_dimensions" text,"max_active_ads" bigint,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_placements_name" ON "placements" ("name");
@@ -0,0 +1,4 @@
+-- SQLite stored dates as text in the API's format, which this migration
+-- converts there. Postgres always stored them as timestamptz, so there is
+-- nothing to convert, but the version is kept so that both dialects number
+-- their migrations the same.
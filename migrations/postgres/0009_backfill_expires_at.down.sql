@@ -0,0 +1,2 @@
+-- Backfilled expiry dates are kept, since they agree with the TTLs and end
+-- dates they were computed from.
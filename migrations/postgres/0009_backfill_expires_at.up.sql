@@ -0,0 +1,5 @@
+-- Ad spots created before expiry dates were stored have none, so the sweeper
+-- and the status filters took them for ad spots that never expire. They
+-- expire when either their TTL runs out or their flight ends.
+UPDATE "ad_spots" SET "expires_at" = "created_at" + "ttl_minutes" * interval '1 minute' WHERE "expires_at" IS NULL AND "ttl_minutes" <> 0;
+UPDATE "ad_spots" SET "expires_at" = "end_at" WHERE "end_at" IS NOT NULL AND ("expires_at" IS NULL OR "end_at" < "expires_at");
@@ -0,0 +1 @@
+ALTER TABLE "ad_spots" DROP COLUMN "image_size";
@@ -0,0 +1,2 @@
+-- Ad spots give the size of their image, which placements may restrict.
+ALTER TABLE "ad_spots" ADD COLUMN "image_size" text;
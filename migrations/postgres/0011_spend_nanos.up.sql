@@ -0,0 +1,5 @@
+-- Campaign spend is kept in billionths of the currency unit, so that CPM rates
+-- below 1000 micros add up without being rounded on every impression.
+ALTER TABLE "campaign_spends" ADD COLUMN "spend_nanos" bigint NOT NULL DEFAULT 0;
+UPDATE "campaign_spends" SET "spend_nanos" = "spend_micros" * 1000;
+ALTER TABLE "campaign_spends" DROP COLUMN "spend_micros";
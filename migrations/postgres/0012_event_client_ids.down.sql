@@ -0,0 +1,5 @@
+-- Events of different clients sharing an ID can't all be kept, so only the
+-- first one recorded is.
+DELETE FROM "events" AS "later" USING "events" AS "first" WHERE "later"."id" = "first"."id" AND ("later"."timestamp", "later"."client_id") > ("first"."timestamp", "first"."client_id");
+ALTER TABLE "events" DROP CONSTRAINT "events_pkey";
+ALTER TABLE "events" ADD PRIMARY KEY ("id");
@@ -0,0 +1,4 @@
+-- Event IDs are chosen by clients, so they are only unique per client.
+UPDATE "events" SET "client_id" = '' WHERE "client_id" IS NULL;
+ALTER TABLE "events" DROP CONSTRAINT "events_pkey";
+ALTER TABLE "events" ADD PRIMARY KEY ("id", "client_id");
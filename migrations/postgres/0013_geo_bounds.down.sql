@@ -0,0 +1,4 @@
+ALTER TABLE "ad_spots" DROP COLUMN "geo_south";
+ALTER TABLE "ad_spots" DROP COLUMN "geo_west";
+ALTER TABLE "ad_spots" DROP COLUMN "geo_north";
+ALTER TABLE "ad_spots" DROP COLUMN "geo_east";
@@ -0,0 +1,4 @@
+-- SQLite databases of the first release stored statuses as booleans, which
+-- this migration names there. Postgres was only supported once statuses were
+-- named, so there is nothing to rewrite, but the version is kept so that both
+-- dialects number their migrations the same.
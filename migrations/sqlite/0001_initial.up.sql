@@ -0,0 +1,4 @@
+-- The schema of the first release, which db.AutoMigrate created. The table is
+-- only created if missing, so that databases of that release can adopt
+-- migrations as they are.
+CREATE TABLE IF NOT EXISTS `ad_spots` (`id` text,`title` text,`image_url` text,`placement` integer,`status` numeric,`ttl_minutes` integer,`created_at` text,`deactivated_at` text,PRIMARY KEY (`id`));
@@ -0,0 +1,17 @@
+DROP INDEX `idx_ad_spots_campaign_id`;
+DROP INDEX `idx_ad_spots_priority`;
+DROP INDEX `idx_ad_spots_expires_at`;
+DROP INDEX `idx_ad_spots_start_at`;
+ALTER TABLE `ad_spots` DROP COLUMN `creatives`;
+ALTER TABLE `ad_spots` DROP COLUMN `targeting`;
+ALTER TABLE `ad_spots` DROP COLUMN `geo`;
+ALTER TABLE `ad_spots` DROP COLUMN `schedule`;
+ALTER TABLE `ad_spots` DROP COLUMN `end_at`;
+ALTER TABLE `ad_spots` DROP COLUMN `start_at`;
+ALTER TABLE `ad_spots` DROP COLUMN `frequency_cap`;
+ALTER TABLE `ad_spots` DROP COLUMN `max_impressions`;
+ALTER TABLE `ad_spots` DROP COLUMN `expires_at`;
+ALTER TABLE `ad_spots` DROP COLUMN `deactivation_reason`;
+ALTER TABLE `ad_spots` DROP COLUMN `weight`;
+ALTER TABLE `ad_spots` DROP COLUMN `priority`;
+ALTER TABLE `ad_spots` DROP COLUMN `campaign_id`;
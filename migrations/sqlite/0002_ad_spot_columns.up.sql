@@ -0,0 +1,19 @@
+-- Lifecycles, campaigns, priorities, caps, flights, schedules and targeting
+-- of ad spots.
+ALTER TABLE `ad_spots` ADD COLUMN `campaign_id` text;
+ALTER TABLE `ad_spots` ADD COLUMN `priority` integer;
+ALTER TABLE `ad_spots` ADD COLUMN `weight` integer DEFAULT 1;
+ALTER TABLE `ad_spots` ADD COLUMN `deactivation_reason` text;
+ALTER TABLE `ad_spots` ADD COLUMN `expires_at` datetime;
+ALTER TABLE `ad_spots` ADD COLUMN `max_impressions` integer;
+ALTER TABLE `ad_spots` ADD COLUMN `frequency_cap` text;
+ALTER TABLE `ad_spots` ADD COLUMN `start_at` datetime;
+ALTER TABLE `ad_spots` ADD COLUMN `end_at` datetime;
+ALTER TABLE `ad_spots` ADD COLUMN `schedule` text;
+ALTER TABLE `ad_spots` ADD COLUMN `geo` text;
+ALTER TABLE `ad_spots` ADD COLUMN `targeting` text;
+ALTER TABLE `ad_spots` ADD COLUMN `creatives` text;
+CREATE INDEX `idx_ad_spots_start_at` ON `ad_spots`(`start_at`);
+CREATE INDEX `idx_ad_spots_expires_at` ON `ad_spots`(`expires_at`);
+CREATE INDEX `idx_ad_spots_priority` ON `ad_spots`(`priority`);
+CREATE INDEX `idx_ad_spots_campaign_id` ON `ad_spots`(`campaign_id`);
@@ -0,0 +1,9 @@
+-- Impressions and clicks, and their hourly counts per ad spot and creative.
+CREATE TABLE `events` (`id` text,`ad_spot_id` text,`type` text,`placement` integer,`campaign_id` text,`creative_id` text,`client_id` text,`timestamp` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_events_timestamp` ON `events`(`timestamp`);
+CREATE INDEX `idx_events_client_id` ON `events`(`client_id`);
+CREATE INDEX `idx_events_ad_spot_id` ON `events`(`ad_spot_id`);
+
+CREATE TABLE `event_rollups` (`ad_spot_id` text,`placement` integer,`bucket` datetime,`impressions` integer,`clicks` integer,PRIMARY KEY (`ad_spot_id`,`placement`,`bucket`));
+
+CREATE TABLE `creative_rollups` (`ad_spot_id` text,`creative_id` text,`bucket` datetime,`impressions` integer,`clicks` integer,PRIMARY KEY (`ad_spot_id`,`creative_id`,`bucket`));
@@ -0,0 +1,7 @@
+-- Advertisers, their campaigns, and the daily spend of each campaign.
+CREATE TABLE `advertisers` (`id` text,`name` text,`created_at` datetime,PRIMARY KEY (`id`));
+
+CREATE TABLE `campaigns` (`id` text,`advertiser_id` text,`name` text,`status` text,`created_at` datetime,`daily_budget_micros` integer,`lifetime_budget_micros` integer,`pricing` integer,`rate_micros` integer,`pacing` integer DEFAULT 1,PRIMARY KEY (`id`));
+CREATE INDEX `idx_campaigns_advertiser_id` ON `campaigns`(`advertiser_id`);
+
+CREATE TABLE `campaign_spends` (`campaign_id` text,`day` datetime,`spend_micros` integer,PRIMARY KEY (`campaign_id`,`day`));
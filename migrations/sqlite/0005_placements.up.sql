@@ -0,0 +1,4 @@
+-- Placements, which used to be built in. The built-in ones are stored when
+-- the server starts.
+CREATE TABLE `placements` (`id` integer,`name` text,`description` text,`allowed_dimensions` text,`max_active_ads` integer,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX `idx_placements_name` ON `placements`(`name`);
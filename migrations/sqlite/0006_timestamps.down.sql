@@ -0,0 +1,13 @@
+-- Writes dates back in the API's format, which older versions expect.
+UPDATE `ad_spots` SET `created_at` = strftime('%Y-%m-%dT%H:%M:%S', `created_at`) || '+0000' WHERE length(`created_at`) = 25 AND substr(`created_at`, 11, 1) = ' ';
+UPDATE `ad_spots` SET `deactivated_at` = strftime('%Y-%m-%dT%H:%M:%S', `deactivated_at`) || '+0000' WHERE length(`deactivated_at`) = 25 AND substr(`deactivated_at`, 11, 1) = ' ';
+UPDATE `ad_spots` SET `expires_at` = strftime('%Y-%m-%dT%H:%M:%S', `expires_at`) || '+0000' WHERE length(`expires_at`) = 25 AND substr(`expires_at`, 11, 1) = ' ';
+UPDATE `ad_spots` SET `start_at` = strftime('%Y-%m-%dT%H:%M:%S', `start_at`) || '+0000' WHERE length(`start_at`) = 25 AND substr(`start_at`, 11, 1) = ' ';
+UPDATE `ad_spots` SET `end_at` = strftime('%Y-%m-%dT%H:%M:%S', `end_at`) || '+0000' WHERE length(`end_at`) = 25 AND substr(`end_at`, 11, 1) = ' ';
+UPDATE `events` SET `timestamp` = strftime('%Y-%m-%dT%H:%M:%S', `timestamp`) || '+0000' WHERE length(`timestamp`) = 25 AND substr(`timestamp`, 11, 1) = ' ';
+UPDATE `event_rollups` SET `bucket` = strftime('%Y-%m-%dT%H:%M:%S', `bucket`) || '+0000' WHERE length(`bucket`) = 25 AND substr(`bucket`, 11, 1) = ' ';
+UPDATE `advertisers` SET `created_at` = strftime('%Y-%m-%dT%H:%M:%S', `created_at`) || '+0000' WHERE length(`created_at`) = 25 AND substr(`created_at`, 11, 1) = ' ';
+UPDATE `campaigns` SET `created_at` = strftime('%Y-%m-%dT%H:%M:%S', `created_at`) || '+0000' WHERE length(`created_at`) = 25 AND substr(`created_at`, 11, 1) = ' ';
+UPDATE `campaign_spends` SET `day` = strftime('%Y-%m-%dT%H:%M:%S', `day`) || '+0000' WHERE length(`day`) = 25 AND substr(`day`, 11, 1) = ' ';
+UPDATE `creative_rollups` SET `bucket` = strftime('%Y-%m-%dT%H:%M:%S', `bucket`) || '+0000' WHERE length(`bucket`) = 25 AND substr(`bucket`, 11, 1) = ' ';
+UPDATE `placements` SET `created_at` = strftime('%Y-%m-%dT%H:%M:%S', `created_at`) || '+0000' WHERE length(`created_at`) = 25 AND substr(`created_at`, 11, 1) = ' ';
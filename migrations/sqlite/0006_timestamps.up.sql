@@ -0,0 +1,15 @@
+-- Dates used to be stored as text in the API's format, such as
+-- 2006-01-02T15:04:05-0700, which compares wrongly across offsets. They are
+-- now written as UTC timestamps, like 2006-01-02 15:04:05+00:00.
+UPDATE `ad_spots` SET `created_at` = strftime('%Y-%m-%d %H:%M:%S', substr(`created_at`, 1, 22) || ':' || substr(`created_at`, 23, 2)) || '+00:00' WHERE length(`created_at`) = 24 AND substr(`created_at`, 11, 1) = 'T';
+UPDATE `ad_spots` SET `deactivated_at` = strftime('%Y-%m-%d %H:%M:%S', substr(`deactivated_at`, 1, 22) || ':' || substr(`deactivated_at`, 23, 2)) || '+00:00' WHERE length(`deactivated_at`) = 24 AND substr(`deactivated_at`, 11, 1) = 'T';
+UPDATE `ad_spots` SET `expires_at` = strftime('%Y-%m-%d %H:%M:%S', substr(`expires_at`, 1, 22) || ':' || substr(`expires_at`, 23, 2)) || '+00:00' WHERE length(`expires_at`) = 24 AND substr(`expires_at`, 11, 1) = 'T';
+UPDATE `ad_spots` SET `start_at` = strftime('%Y-%m-%d %H:%M:%S', substr(`start_at`, 1, 22) || ':' || substr(`start_at`, 23, 2)) || '+00:00' WHERE length(`start_at`) = 24 AND substr(`start_at`, 11, 1) = 'T';
+UPDATE `ad_spots` SET `end_at` = strftime('%Y-%m-%d %H:%M:%S', substr(`end_at`, 1, 22) || ':' || substr(`end_at`, 23, 2)) || '+00:00' WHERE length(`end_at`) = 24 AND substr(`end_at`, 11, 1) = 'T';
+UPDATE `events` SET `timestamp` = strftime('%Y-%m-%d %H:%M:%S', substr(`timestamp`, 1, 22) || ':' || substr(`timestamp`, 23, 2)) || '+00:00' WHERE length(`timestamp`) = 24 AND substr(`timestamp`, 11, 1) = 'T';
+UPDATE `event_rollups` SET `bucket` = strftime('%Y-%m-%d %H:%M:%S', substr(`bucket`, 1, 22) || ':' || substr(`bucket`, 23, 2)) || '+00:00' WHERE length(`bucket`) = 24 AND substr(`bucket`, 11, 1) = 'T';
+UPDATE `advertisers` SET `created_at` = strftime('%Y-%m-%d %H:%M:%S', substr(`created_at`, 1, 22) || ':' || substr(`created_at`, 23, 2)) || '+00:00' WHERE length(`created_at`) = 24 AND substr(`created_at`, 11, 1) = 'T';
+UPDATE `campaigns` SET `created_at` = strftime('%Y-%m-%d %H:%M:%S', substr(`created_at`, 1, 22) || ':' || substr(`created_at`, 23, 2)) || '+00:00' WHERE length(`created_at`) = 24 AND substr(`created_at`, 11, 1) = 'T';
+UPDATE `campaign_spends` SET `day` = strftime('%Y-%m-%d %H:%M:%S', substr(`day`, 1, 22) || ':' || substr(`day`, 23, 2)) || '+00:00' WHERE length(`day`) = 24 AND substr(`day`, 11, 1) = 'T';
+UPDATE `creative_rollups` SET `bucket` = strftime('%Y-%m-%d %H:%M:%S', substr(`bucket`, 1, 22) || ':' || substr(`bucket`, 23, 2)) || '+00:00' WHERE length(`bucket`) = 24 AND substr(`bucket`, 11, 1) = 'T';
+UPDATE `placements` SET `created_at` = strftime('%Y-%m-%d %H:%M:%S', substr(`created_at`, 1, 22) || ':' || substr(`created_at`, 23, 2)) || '+00:00' WHERE length(`created_at`) = 24 AND substr(`created_at`, 11, 1) = 'T';
@@ -0,0 +1,2 @@
+-- Every change to an ad spot bumps its version, which clients see as its ETag.
+ALTER TABLE `ad_spots` ADD COLUMN `version` integer NOT NULL DEFAULT 1;
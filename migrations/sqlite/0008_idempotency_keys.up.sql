@@ -0,0 +1,4 @@
+-- Responses to POST requests sent with an Idempotency-Key header, replayed
+-- when the request is retried.
+CREATE TABLE `idempotency_keys` (`key` text,`fingerprint` text,`status_code` integer,`header` text,`body` blob,`created_at` datetime,PRIMARY KEY (`key`));
+CREATE INDEX `idx_idempotency_keys_created_at` ON `idempotency_keys`(`created_at`);
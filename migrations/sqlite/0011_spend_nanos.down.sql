@@ -0,0 +1,3 @@
+ALTER TABLE `campaign_spends` ADD COLUMN `spend_micros` integer;
+UPDATE `campaign_spends` SET `spend_micros` = `spend_nanos` / 1000;
+ALTER TABLE `campaign_spends` DROP COLUMN `spend_nanos`;
@@ -0,0 +1,9 @@
+-- Events of different clients sharing an ID can't all be kept, so only the
+-- first one recorded is.
+CREATE TABLE `events_new` (`id` text,`ad_spot_id` text,`type` text,`placement` integer,`campaign_id` text,`creative_id` text,`client_id` text,`timestamp` datetime,PRIMARY KEY (`id`));
+INSERT OR IGNORE INTO `events_new` (`id`, `ad_spot_id`, `type`, `placement`, `campaign_id`, `creative_id`, `client_id`, `timestamp`) SELECT `id`, `ad_spot_id`, `type`, `placement`, `campaign_id`, `creative_id`, `client_id`, `timestamp` FROM `events` ORDER BY `timestamp`;
+DROP TABLE `events`;
+ALTER TABLE `events_new` RENAME TO `events`;
+CREATE INDEX `idx_events_timestamp` ON `events`(`timestamp`);
+CREATE INDEX `idx_events_client_id` ON `events`(`client_id`);
+CREATE INDEX `idx_events_ad_spot_id` ON `events`(`ad_spot_id`);
@@ -0,0 +1,7 @@
+-- The bounding box of geo targets, so that ad spots can be listed by point in
+-- SQL. Ad spots targeted before are only boxed once written to again, and
+-- are listed as candidates meanwhile.
+ALTER TABLE `ad_spots` ADD COLUMN `geo_south` real;
+ALTER TABLE `ad_spots` ADD COLUMN `geo_west` real;
+ALTER TABLE `ad_spots` ADD COLUMN `geo_north` real;
+ALTER TABLE `ad_spots` ADD COLUMN `geo_east` real;
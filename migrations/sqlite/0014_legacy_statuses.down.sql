@@ -0,0 +1 @@
+-- Statuses stay named, which every version since the lifecycle reads.
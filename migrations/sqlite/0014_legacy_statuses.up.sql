@@ -0,0 +1,4 @@
+-- Before the lifecycle, the status was a boolean, which SQLite stored as 1 or
+-- 0. Scanning still understands those, but SQL filters compare names.
+UPDATE `ad_spots` SET `status` = 'active' WHERE `status` IN (1, '1', 'true');
+UPDATE `ad_spots` SET `status` = 'deactivated' WHERE `status` IN (0, '0', 'false');
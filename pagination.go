@@ -0,0 +1,141 @@
+package adspots
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// Lists are sorted newest first by default. Sorting by priority puts the
+// highest priority first, and then the newest within each priority.
+const (
+	SortCreatedAt = "createdAt"
+	SortPriority  = "priority"
+)
+
+var InvalidCursor = errors.New("invalid cursor value")
+var InvalidLimit = errors.New("invalid limit value")
+var InvalidSort = errors.New("invalid sort value")
+
+// Cursor marks the position after the last row of a page. Rows are ordered by
+// the sort key, then by creation date and then by ID, so rows sharing a
+// creation date are still returned exactly once. A cursor can only be used
+// with the sort order it was issued for.
+type Cursor struct {
+	Sort      string  `json:"s,omitempty"`
+	Priority  int     `json:"p,omitempty"`
+	CreatedAt ISO8601 `json:"c"`
+	ID        string  `json:"i"`
+}
+
+// ListResponse is the envelope returned by GET /adspots. NextCursor is null on
+// the last page.
+type ListResponse struct {
+	Data       []AdSpot `json:"data"`
+	NextCursor *string  `json:"nextCursor"`
+}
+
+func (c Cursor) Encode() string {
+	buf, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func (c *Cursor) Decode(value string) error {
+	buf, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return InvalidCursor
+	}
+	if err := json.Unmarshal(buf, c); err != nil || c.ID == "" {
+		return InvalidCursor
+	}
+	return nil
+}
+
+// cursorAfter returns the cursor pointing past the ad spot in the sort order.
+func cursorAfter(spot AdSpot, sort string) Cursor {
+	cursor := Cursor{CreatedAt: spot.CreatedAt, ID: spot.ID}
+	if sort == SortPriority {
+		cursor.Sort = sort
+		cursor.Priority = spot.Priority
+	}
+	return cursor
+}
+
+// parseSort reads the sort order, falling back to SortCreatedAt when empty.
+func parseSort(value string) (string, error) {
+	switch value {
+	case "", SortCreatedAt:
+		return SortCreatedAt, nil
+	case SortPriority:
+		return SortPriority, nil
+	}
+	return "", InvalidSort
+}
+
+// orderClause returns the SQL ORDER BY clause of the sort order.
+func orderClause(sort string) string {
+	if sort == SortPriority {
+		return "priority desc, created_at desc, id desc"
+	}
+	return "created_at desc, id desc"
+}
+
+// compareAdSpots orders ad spots like orderClause does. Creation dates are
+// compared down to the second, as stored.
+func compareAdSpots(sort string) func(a, b AdSpot) int {
+	return func(a, b AdSpot) int {
+		if sort == SortPriority && a.Priority != b.Priority {
+			return cmp.Compare(b.Priority, a.Priority)
+		}
+		if c := time.Time(b.CreatedAt).Truncate(time.Second).Compare(time.Time(a.CreatedAt).Truncate(time.Second)); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	}
+}
+
+// sort returns the sort order the cursor was issued for. Cursors issued before
+// sorting was introduced don't name one.
+func (c Cursor) sort() string {
+	if c.Sort == "" {
+		return SortCreatedAt
+	}
+	return c.Sort
+}
+
+// condition returns the SQL condition matching the rows following the
+// cursor.
+func (c Cursor) condition() (string, []any) {
+	const afterCreated = "created_at < ? OR (created_at = ? AND id < ?)"
+	if c.Sort == SortPriority {
+		return "priority < ? OR (priority = ? AND (" + afterCreated + "))",
+			[]any{c.Priority, c.Priority, c.CreatedAt, c.CreatedAt, c.ID}
+	}
+	return afterCreated, []any{c.CreatedAt, c.CreatedAt, c.ID}
+}
+
+// precedes reports whether the ad spot follows the cursor.
+func (c Cursor) precedes(spot AdSpot) bool {
+	last := AdSpot{Priority: c.Priority, CreatedAt: c.CreatedAt, ID: c.ID}
+	return compareAdSpots(c.sort())(last, spot) < 0
+}
+
+// parseLimit reads the page size, falling back to DefaultPageSize when empty.
+func parseLimit(value string) (int, error) {
+	if value == "" {
+		return DefaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > MaxPageSize {
+		return 0, InvalidLimit
+	}
+	return limit, nil
+}
@@ -0,0 +1,376 @@
+package adspots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	// PlacementConfig describes a placement. Ad spots still store the numeric
+	// ID of their placement, and refer to it by name on the wire.
+	PlacementConfig struct {
+		ID                Placement    `json:"-" gorm:"primaryKey;autoIncrement:false"`
+		Name              string       `json:"name" gorm:"uniqueIndex"`
+		Description       string       `json:"description"`
+		AllowedDimensions []Dimensions `json:"allowedDimensions,omitempty" gorm:"serializer:json"`
+		MaxActiveAds      *int         `json:"maxActiveAds,omitempty"`
+		CreatedAt         ISO8601      `json:"createdAt"`
+	}
+
+	// Dimensions are the size of an image in pixels.
+	Dimensions struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	}
+
+	PlacementPayload struct {
+		Name              *string      `json:"name"`
+		Description       *string      `json:"description"`
+		AllowedDimensions []Dimensions `json:"allowedDimensions"`
+		MaxActiveAds      *int         `json:"maxActiveAds"`
+	}
+
+	// PlacementStore persists placements.
+	PlacementStore interface {
+		// ListPlacements returns every stored placement, ordered by ID.
+		ListPlacements(ctx context.Context) ([]PlacementConfig, error)
+		// GetPlacement returns the stored placement, or the zero value if
+		// there is none.
+		GetPlacement(ctx context.Context, id Placement) (PlacementConfig, error)
+		// CreatePlacement stores the placement under the next free ID, which
+		// it sets, unless its name is taken.
+		CreatePlacement(ctx context.Context, config *PlacementConfig) (nameTaken bool, err error)
+	}
+
+	// placementRegistry maps placement IDs to names and back. Each server
+	// keeps its own, read from its store.
+	placementRegistry struct {
+		store    PlacementStore
+		mu       sync.RWMutex
+		names    map[Placement]string
+		byName   map[string]Placement
+		loadedAt time.Time
+	}
+)
+
+// placementReloadInterval bounds how long a server takes to see placements
+// created by other processes, and placementMissReloadInterval how often
+// unknown placements make it look for them right away.
+const (
+	placementReloadInterval     = time.Minute
+	placementMissReloadInterval = time.Second
+)
+
+// placementIDAttempts bounds how many IDs a new placement tries, as other
+// placements created meanwhile may take them.
+const placementIDAttempts = 5
+
+// builtinPlacements predate the placements table, and are always known.
+var builtinPlacements = []PlacementConfig{
+	{ID: PlacementHomeScreen, Name: "home_screen", Description: "Home screen banner"},
+	{ID: PlacementRideSummary, Name: "ride_summary", Description: "Ride summary card"},
+	{ID: PlacementMapView, Name: "map_view", Description: "Map view pin"},
+}
+
+// nextPlacementID returns the ID following the last one stored, leaving the
+// built-in IDs alone.
+func nextPlacementID(last Placement) Placement {
+	return max(last, PlacementMapView) + 1
+}
+
+var PlacementFull = errors.New("placement has reached its maximum number of active ads")
+
+var placementName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+func newPlacementRegistry(store PlacementStore) *placementRegistry {
+	registry := &placementRegistry{
+		store:  store,
+		names:  make(map[Placement]string),
+		byName: make(map[string]Placement),
+	}
+	for _, placement := range builtinPlacements {
+		registry.register(placement.ID, placement.Name)
+	}
+	return registry
+}
+
+func (pr *placementRegistry) register(id Placement, name string) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if previous, ok := pr.names[id]; ok {
+		delete(pr.byName, previous)
+	}
+	pr.names[id] = name
+	pr.byName[name] = id
+}
+
+// reload registers every stored placement. Failing to read them is only
+// logged, since the placements registered already can still be used.
+func (pr *placementRegistry) reload(ctx context.Context) {
+	stored, err := pr.store.ListPlacements(ctx)
+	if err != nil {
+		log.Print("error while loading placements: ", err)
+		return
+	}
+	for _, placement := range stored {
+		pr.register(placement.ID, placement.Name)
+	}
+	pr.mu.Lock()
+	pr.loadedAt = time.Now()
+	pr.mu.Unlock()
+}
+
+// find calls known under the read lock, reloading the registry first if it
+// is stale, and again if known reports false and the last reload is old
+// enough.
+func (pr *placementRegistry) find(ctx context.Context, known func() bool) bool {
+	age := func() time.Duration {
+		pr.mu.RLock()
+		defer pr.mu.RUnlock()
+		return time.Since(pr.loadedAt)
+	}
+	found := func() bool {
+		pr.mu.RLock()
+		defer pr.mu.RUnlock()
+		return known()
+	}
+
+	if age() >= placementReloadInterval {
+		pr.reload(ctx)
+	}
+	if found() {
+		return true
+	}
+	if age() < placementMissReloadInterval {
+		return false
+	}
+	pr.reload(ctx)
+	return found()
+}
+
+func (pr *placementRegistry) name(ctx context.Context, id Placement) (name string, ok bool) {
+	ok = pr.find(ctx, func() bool {
+		name, ok = pr.names[id]
+		return ok
+	})
+	return name, ok
+}
+
+func (pr *placementRegistry) lookup(ctx context.Context, name string) (id Placement, ok bool) {
+	ok = pr.find(ctx, func() bool {
+		id, ok = pr.byName[name]
+		return ok
+	})
+	return id, ok
+}
+
+// namePlacements looks up the names of the ad spots' placements, which their
+// responses use.
+func (s *Server) namePlacements(ctx context.Context, spots []AdSpot) {
+	for i := range spots {
+		if name, ok := s.placements.name(ctx, spots[i].Placement); ok {
+			spots[i].placementName = name
+		}
+	}
+}
+
+func (PlacementConfig) TableName() string {
+	return "placements"
+}
+
+func (p PlacementPayload) validate() []string {
+	var validationErrors []string
+	if p.Name == nil || !placementName.MatchString(*p.Name) {
+		validationErrors = append(validationErrors, "Name field must start with a lowercase letter and only contain lowercase letters, digits and underscores")
+	}
+	for i, dimensions := range p.AllowedDimensions {
+		if dimensions.Width <= 0 || dimensions.Height <= 0 {
+			validationErrors = append(validationErrors, fmt.Sprintf("Allowed dimensions %d must have a positive width and height", i))
+		}
+	}
+	if p.MaxActiveAds != nil && *p.MaxActiveAds <= 0 {
+		validationErrors = append(validationErrors, "Max active ads field must be positive")
+	}
+	return validationErrors
+}
+
+// LoadPlacements stores the built-in placements in the database if they are
+// missing. It must be called once the placements table exists.
+func LoadPlacements(ctx context.Context, db *gorm.DB) error {
+	for _, placement := range builtinPlacements {
+		placement.CreatedAt = ISO8601(time.Now())
+		if err := gorm.G[PlacementConfig](db, clause.OnConflict{DoNothing: true}).Create(ctx, &placement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateImageSize checks the size of the ad spot's image against the
+// dimensions its placement allows, if it restricts them. Creatives are shown
+// in the same slot, so they must have the same size.
+func (s *Server) validateImageSize(ctx context.Context, placement Placement, p CreatePayload) ([]string, error) {
+	config, err := s.store.GetPlacement(ctx, placement)
+	if err != nil || len(config.AllowedDimensions) == 0 {
+		return nil, err
+	}
+	if p.ImageSize == nil {
+		return []string{"Image size field cannot be missing, as the placement restricts image dimensions"}, nil
+	}
+	if !slices.Contains(config.AllowedDimensions, *p.ImageSize) {
+		return []string{fmt.Sprintf("Image size %dx%d is not allowed by the placement", p.ImageSize.Width, p.ImageSize.Height)}, nil
+	}
+	return nil, nil
+}
+
+// writeWithinLimit calls write with the server's store. If the ad spot is
+// active and its placement has a limit, the active ad spots of the placement
+// are counted in the same transaction, excluding the ad spot itself, and
+// PlacementFull is returned if there is no room for it.
+func (s *Server) writeWithinLimit(ctx context.Context, spot AdSpot, write func(AdSpotStore) error) error {
+	if spot.Status != StatusActive {
+		return write(s.store)
+	}
+	config, err := s.store.GetPlacement(ctx, spot.Placement)
+	if err != nil {
+		return err
+	}
+	limit := config.MaxActiveAds
+	if limit == nil {
+		return write(s.store)
+	}
+
+	return s.store.Transaction(ctx, spot.Placement, func(store AdSpotStore) error {
+		spots, err := store.List(ctx, AdSpotFilter{
+			Placement: &spot.Placement,
+			Effective: []EffectiveStatus{EffectiveActive, EffectiveScheduled},
+		})
+		if err != nil {
+			return err
+		}
+		active := len(slices.DeleteFunc(spots, func(a AdSpot) bool { return a.ID == spot.ID }))
+		if active >= *limit {
+			return PlacementFull
+		}
+		return write(store)
+	})
+}
+
+// placementFull answers with 409 Conflict to writes of an active ad spot
+// that failed with PlacementFull.
+func placementFull(w http.ResponseWriter, spot AdSpot) {
+	JSONError(w, map[string]string{
+		"what":      "Placement has reached its maximum number of active ads",
+		"placement": spot.placementString(),
+	}, http.StatusConflict)
+}
+
+func (s *Server) ListPlacements(w http.ResponseWriter, r *http.Request) {
+	configs, err := s.store.ListPlacements(r.Context())
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	if configs == nil {
+		configs = []PlacementConfig{}
+	}
+	JSONResponse(w, map[string]any{"data": configs}, http.StatusOK)
+}
+
+// CreatePlacement stores a new placement, which ad spots can use right away.
+func (s *Server) CreatePlacement(w http.ResponseWriter, r *http.Request) {
+	var payload PlacementPayload
+	if !decodeStrict(w, r.Body, &payload) {
+		return
+	}
+
+	if validationErrors := payload.validate(); len(validationErrors) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Failed to validate JSON payload",
+			"context": validationErrors,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	config := PlacementConfig{
+		Name:              *payload.Name,
+		AllowedDimensions: payload.AllowedDimensions,
+		MaxActiveAds:      payload.MaxActiveAds,
+		CreatedAt:         ISO8601(time.Now()),
+	}
+	if payload.Description != nil {
+		config.Description = *payload.Description
+	}
+
+	conflict, err := s.store.CreatePlacement(r.Context(), &config)
+	if err != nil {
+		JSONError(w, map[string]any{
+			"what":    "Failed to persist placement",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	if conflict {
+		JSONError(w, map[string]string{
+			"what": "Placement name is already taken",
+			"name": config.Name,
+		}, http.StatusConflict)
+		return
+	}
+
+	s.placements.register(config.ID, config.Name)
+	JSONResponse(w, config, http.StatusCreated)
+}
+
+func (gs *GormStore) ListPlacements(ctx context.Context) ([]PlacementConfig, error) {
+	return gorm.G[PlacementConfig](gs.db).Order("id").Find(ctx)
+}
+
+func (gs *GormStore) GetPlacement(ctx context.Context, id Placement) (PlacementConfig, error) {
+	configs, err := gorm.G[PlacementConfig](gs.db).Where("id = ?", id).Find(ctx)
+	if err != nil || len(configs) == 0 {
+		return PlacementConfig{}, err
+	}
+	return configs[0], nil
+}
+
+// CreatePlacement skips rows conflicting on the ID or the name rather than
+// failing, so that losing a race for the ID is retried with the next one,
+// while a taken name is reported.
+func (gs *GormStore) CreatePlacement(ctx context.Context, config *PlacementConfig) (nameTaken bool, err error) {
+	for range placementIDAttempts {
+		var last struct{ ID Placement }
+		if err := gorm.G[PlacementConfig](gs.db).Select("COALESCE(MAX(id), 0) AS id").Scan(ctx, &last); err != nil {
+			return false, err
+		}
+		config.ID = nextPlacementID(last.ID)
+
+		result := gorm.WithResult()
+		if err := gorm.G[PlacementConfig](gs.db, clause.OnConflict{DoNothing: true}, result).Create(ctx, config); err != nil {
+			return false, err
+		}
+		if result.RowsAffected > 0 {
+			return false, nil
+		}
+
+		taken, err := gorm.G[PlacementConfig](gs.db).Where("name = ?", config.Name).Count(ctx, "id")
+		if err != nil || taken > 0 {
+			return taken > 0, err
+		}
+	}
+	return false, fmt.Errorf("no free placement ID after %d attempts", placementIDAttempts)
+}
@@ -24,6 +24,8 @@ type RateLimiter struct {
 	capacity   int           // Max tokens per bucket
 	refillRate int           // Tokens per second
 	cleanup    time.Duration // How often to clean up expired buckets
+	done       chan struct{} // Closed to stop the cleanup goroutine
+	stopOnce   sync.Once
 }
 
 type RateLimiterConfig struct {
@@ -48,6 +50,7 @@ func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
 		capacity:   config.BurstSize,
 		refillRate: config.RequestsPerSecond,
 		cleanup:    config.CleanupInterval,
+		done:       make(chan struct{}),
 	}
 
 	go rl.startCleanup()
@@ -118,11 +121,22 @@ func (rl *RateLimiter) startCleanup() {
 	ticker := time.NewTicker(rl.cleanup)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		rl.cleanupOldBuckets()
+	for {
+		select {
+		case <-ticker.C:
+			rl.cleanupOldBuckets()
+		case <-rl.done:
+			return
+		}
 	}
 }
 
+// Stop terminates the background cleanup goroutine. It is safe to call more
+// than once.
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() { close(rl.done) })
+}
+
 func (rl *RateLimiter) cleanupOldBuckets() {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
@@ -0,0 +1,311 @@
+package adspots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Granularity int
+
+	// EventRollup holds the number of events per ad spot, placement and hour.
+	// It is kept up to date as events are recorded, so that reports never have
+	// to scan the events table.
+	EventRollup struct {
+		AdSpotID    string    `gorm:"primaryKey"`
+		Placement   Placement `gorm:"primaryKey"`
+		Bucket      ISO8601   `gorm:"primaryKey"`
+		Impressions int64
+		Clicks      int64
+	}
+
+	// Counts are the aggregated events of a report row.
+	Counts struct {
+		Impressions int64   `json:"impressions"`
+		Clicks      int64   `json:"clicks"`
+		CTR         float64 `json:"ctr"`
+	}
+	BucketStats struct {
+		Start ISO8601 `json:"start"`
+		Counts
+	}
+	AdSpotStats struct {
+		AdSpotID    string          `json:"adSpotId"`
+		Granularity Granularity     `json:"granularity"`
+		From        ISO8601         `json:"from"`
+		To          ISO8601         `json:"to"`
+		Totals      Counts          `json:"totals"`
+		Buckets     []BucketStats   `json:"buckets"`
+		Creatives   []CreativeStats `json:"creatives,omitempty"`
+	}
+	PlacementStats struct {
+		Placement string `json:"placement"`
+		Counts
+	}
+	PlacementReport struct {
+		From ISO8601          `json:"from"`
+		To   ISO8601          `json:"to"`
+		Data []PlacementStats `json:"data"`
+	}
+)
+
+const (
+	GranularityHour Granularity = 1
+	GranularityDay  Granularity = 2
+)
+
+// Reports default to the last week, and span at most a quarter.
+const (
+	defaultReportSpan = 7 * 24 * time.Hour
+	maxReportSpan     = 92 * 24 * time.Hour
+)
+
+var InvalidGranularity = errors.New("invalid granularity value")
+
+func (g Granularity) String() string {
+	switch g {
+	case GranularityHour:
+		return "hour"
+	case GranularityDay:
+		return "day"
+	}
+	return "invalid"
+}
+
+func (g *Granularity) Parse(value string) error {
+	switch value {
+	case "hour":
+		*g = GranularityHour
+	case "day":
+		*g = GranularityDay
+	default:
+		return InvalidGranularity
+	}
+	return nil
+}
+
+func (g Granularity) MarshalJSON() ([]byte, error) {
+	return fmt.Appendf([]byte{}, "%q", g.String()), nil
+}
+
+func (g *Granularity) UnmarshalJSON(buf []byte) error {
+	value := strings.Trim(string(buf), `"`)
+	return g.Parse(value)
+}
+
+// Duration returns the length of a bucket. Buckets are aligned on UTC.
+func (g Granularity) Duration() time.Duration {
+	if g == GranularityDay {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+func (c *Counts) add(impressions, clicks int64) {
+	c.Impressions += impressions
+	c.Clicks += clicks
+	c.CTR = 0
+	if c.Impressions > 0 {
+		c.CTR = float64(c.Clicks) / float64(c.Impressions)
+	}
+}
+
+// rollupBucket returns the hourly bucket an instant falls into.
+func rollupBucket(t time.Time) ISO8601 {
+	return ISO8601(t.UTC().Truncate(time.Hour))
+}
+
+// rollupEvent adds a newly recorded event to its hourly rollup.
+func rollupEvent(ctx context.Context, tx *gorm.DB, event Event) error {
+	rollup := EventRollup{
+		AdSpotID:  event.AdSpotID,
+		Placement: event.Placement,
+		Bucket:    rollupBucket(time.Time(event.Timestamp)),
+	}
+	switch event.Type {
+	case EventImpression:
+		rollup.Impressions = 1
+	case EventClick:
+		rollup.Clicks = 1
+	}
+
+	upsert := clause.OnConflict{
+		Columns: []clause.Column{{Name: "ad_spot_id"}, {Name: "placement"}, {Name: "bucket"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "impressions"}, Value: gorm.Expr("event_rollups.impressions + excluded.impressions")},
+			{Column: clause.Column{Name: "clicks"}, Value: gorm.Expr("event_rollups.clicks + excluded.clicks")},
+		},
+	}
+	return gorm.G[EventRollup](tx, upsert).Create(ctx, &rollup)
+}
+
+// parseReportRange reads the from and to query parameters, which default to
+// the last week. The range is widened to the bucket boundaries, and the
+// returned to is exclusive.
+func parseReportRange(r *http.Request, granularity Granularity) (from, to time.Time, err error) {
+	to = time.Now()
+	if value := r.URL.Query().Get("to"); value != "" {
+		var tm ISO8601
+		if err := tm.Parse(value); err != nil {
+			return from, to, fmt.Errorf("invalid value for to field: %w", err)
+		}
+		to = time.Time(tm)
+	}
+
+	from = to.Add(-defaultReportSpan)
+	if value := r.URL.Query().Get("from"); value != "" {
+		var tm ISO8601
+		if err := tm.Parse(value); err != nil {
+			return from, to, fmt.Errorf("invalid value for from field: %w", err)
+		}
+		from = time.Time(tm)
+	}
+
+	step := granularity.Duration()
+	from = from.UTC().Truncate(step)
+	if end := to.UTC().Truncate(step); end.Equal(to) {
+		to = end
+	} else {
+		to = end.Add(step)
+	}
+	if !from.Before(to) || to.Sub(from) > maxReportSpan {
+		return from, to, fmt.Errorf("from must be before to, and at most %d days apart", maxReportSpan/(24*time.Hour))
+	}
+	return from, to, nil
+}
+
+// AdSpotStats reports the impressions, clicks and CTR of an ad spot per hour
+// or per day, along with the totals of each of its creatives. Every bucket of
+// the range is listed, even if empty.
+func (s *Server) AdSpotStats(w http.ResponseWriter, r *http.Request) {
+	spot, ok := s.loadAdSpot(w, r)
+	if !ok {
+		return
+	}
+
+	granularity := GranularityHour
+	if value := r.URL.Query().Get("granularity"); value != "" {
+		if err := granularity.Parse(value); err != nil {
+			JSONError(w, map[string]string{
+				"what": "Invalid value for granularity field",
+			}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	from, to, err := parseReportRange(r, granularity)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Invalid report range",
+			"context": err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	rollups, err := s.store.AdSpotRollups(r.Context(), spot.ID, from, to)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	stats := AdSpotStats{
+		AdSpotID:    spot.ID,
+		Granularity: granularity,
+		From:        ISO8601(from),
+		To:          ISO8601(to),
+	}
+	for start := from; start.Before(to); start = start.Add(granularity.Duration()) {
+		stats.Buckets = append(stats.Buckets, BucketStats{Start: ISO8601(start)})
+	}
+	for _, rollup := range rollups {
+		i := int(time.Time(rollup.Bucket).Sub(from) / granularity.Duration())
+		stats.Buckets[i].add(rollup.Impressions, rollup.Clicks)
+		stats.Totals.add(rollup.Impressions, rollup.Clicks)
+	}
+
+	stats.Creatives, err = s.creativeStats(r.Context(), spot, from, to)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	JSONResponse(w, stats, http.StatusOK)
+}
+
+// PlacementReport rolls up the impressions, clicks and CTR of every placement.
+func (s *Server) PlacementReport(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseReportRange(r, GranularityHour)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Invalid report range",
+			"context": err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	counts, err := s.store.PlacementCounts(r.Context(), from, to)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	report := PlacementReport{
+		From: ISO8601(from),
+		To:   ISO8601(to),
+		Data: []PlacementStats{},
+	}
+	for _, placement := range slices.Sorted(maps.Keys(counts)) {
+		name, ok := s.placements.name(r.Context(), placement)
+		if !ok {
+			name = placement.String()
+		}
+		report.Data = append(report.Data, PlacementStats{Placement: name, Counts: counts[placement]})
+	}
+
+	JSONResponse(w, report, http.StatusOK)
+}
+
+func (gs *GormStore) AdSpotRollups(ctx context.Context, id string, from, to time.Time) ([]EventRollup, error) {
+	return gorm.G[EventRollup](gs.db).
+		Where("ad_spot_id = ? AND bucket >= ? AND bucket < ?", id, ISO8601(from), ISO8601(to)).
+		Find(ctx)
+}
+
+func (gs *GormStore) PlacementCounts(ctx context.Context, from, to time.Time) (map[Placement]Counts, error) {
+	var rows []struct {
+		Placement   Placement
+		Impressions int64
+		Clicks      int64
+	}
+	err := gorm.G[EventRollup](gs.db).
+		Select("placement, SUM(impressions) AS impressions, SUM(clicks) AS clicks").
+		Where("bucket >= ? AND bucket < ?", ISO8601(from), ISO8601(to)).
+		Group("placement").
+		Scan(ctx, &rows)
+
+	counts := make(map[Placement]Counts, len(rows))
+	for _, row := range rows {
+		var c Counts
+		c.add(row.Impressions, row.Clicks)
+		counts[row.Placement] = c
+	}
+	return counts, err
+}
@@ -1,43 +1,32 @@
 package adspots
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"slices"
 	"time"
 
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 )
 
 func (s *Server) CreateAdSpot(w http.ResponseWriter, req *http.Request) {
 	var payload CreatePayload
-	d := json.NewDecoder(req.Body)
-	d.DisallowUnknownFields()
-
-	if err := d.Decode(&payload); err != nil {
-		JSONError(w, map[string]any{
-			"what":    "Failed to decode JSON payload",
-			"context": err.Error(),
-		}, http.StatusBadRequest)
+	if !decodeStrict(w, req.Body, &payload) {
 		return
 	}
 
-	var validationErrors []string
-	if payload.Title == nil {
-		validationErrors = append(validationErrors, "Title field cannot be missing")
-	}
-	if payload.ImageURL == nil {
-		validationErrors = append(validationErrors, "Image URL field cannot be missing")
-	}
-	if payload.Placement == nil {
-		validationErrors = append(validationErrors, "Placement field cannot be missing")
-	}
-	var place Placement
-	if err := place.Parse(*payload.Placement); err != nil {
-		validationErrors = append(validationErrors, "Invalid value for placement field")
+	place, validationErrors := payload.validateCreate(req.Context(), s.placements)
+	storedErrors, err := s.validateStored(req.Context(), place, payload)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Database request failed",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
 	}
-
+	validationErrors = append(validationErrors, storedErrors...)
 	if len(validationErrors) > 0 {
 		JSONError(w, map[string]any{
 			"what":    "Failed to validate JSON payload",
@@ -46,126 +35,294 @@ func (s *Server) CreateAdSpot(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	status := StatusActive
+	if payload.Status != nil {
+		status = *payload.Status
+	}
+
 	adspot := AdSpot{
-		ID:         uuid.NewString(),
-		Title:      *payload.Title,
-		ImageURL:   *payload.ImageURL,
-		Placement:  place,
-		Status:     StatusActive,
-		TTLMinutes: payload.TTLMinutes,
-		CreatedAt:  ISO8601(time.Now()),
+		ID:        uuid.NewString(),
+		Status:    status,
+		CreatedAt: ISO8601(time.Now()),
+		Version:   1,
 	}
+	adspot.apply(payload, place)
 
-	if err := gorm.G[AdSpot](s.db).Create(req.Context(), &adspot); err != nil {
+	err = s.writeWithinLimit(req.Context(), adspot, func(store AdSpotStore) error {
+		return store.Create(req.Context(), adspot)
+	})
+	if errors.Is(err, PlacementFull) {
+		placementFull(w, adspot)
+		return
+	}
+	if err != nil {
 		JSONError(w, map[string]any{
 			"what":    "Failed to persist ad spot",
 			"context": err.Error(),
 		}, http.StatusInternalServerError)
 		return
 	}
+	s.invalidate()
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	e := json.NewEncoder(w)
-	e.Encode(adspot)
+	if adspot.CampaignID != nil {
+		campaign, err := s.store.GetCampaign(req.Context(), *adspot.CampaignID)
+		if err != nil && !errors.Is(err, CampaignNotFound) {
+			JSONError(w, map[string]string{
+				"what":    "Database request failed",
+				"context": err.Error(),
+			}, http.StatusInternalServerError)
+			return
+		}
+		adspot.CampaignInactive = err == nil && campaign.Status != StatusActive
+	}
+	s.writeAdSpot(w, req, adspot)
+}
+
+// validateStored checks the parts of the payload that depend on stored data:
+// its campaign, and the image sizes its placement allows.
+func (s *Server) validateStored(ctx context.Context, place Placement, p CreatePayload) ([]string, error) {
+	campaignErrors, err := s.validateCampaign(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	sizeErrors, err := s.validateImageSize(ctx, place, p)
+	return append(campaignErrors, sizeErrors...), err
 }
 
+// GetAdSpot returns the ad spot along with the state of its impression caps.
+// Passing a clientId includes that client's frequency cap state. Clients
+// holding the current ETag in If-None-Match get 304 Not Modified instead,
+// which they stop getting once the cap state changes too.
 func (s *Server) GetAdSpot(w http.ResponseWriter, r *http.Request) {
+	spot, ok := s.loadAdSpot(w, r)
+	if !ok {
+		return
+	}
+
+	states, err := s.capStates(r.Context(), []AdSpot{spot}, r.URL.Query().Get("clientId"), time.Now())
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Database request failed",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	if state, ok := states[spot.ID]; ok {
+		spot.CapState = &state
+	}
+	s.writeAdSpot(w, r, spot)
+}
+
+// loadAdSpot fetches the ad spot named by the request's id path value, noting
+// the name of its placement and whether its campaign is inactive. If it
+// cannot be found, an error response is written and ok is false.
+func (s *Server) loadAdSpot(w http.ResponseWriter, r *http.Request) (spot AdSpot, ok bool) {
+	get := func(ctx context.Context, id string) (AdSpot, error) {
+		spot, err := s.store.Get(ctx, id)
+		if err != nil {
+			return spot, err
+		}
+		spots := []AdSpot{spot}
+		s.namePlacements(ctx, spots)
+		return spots[0], nil
+	}
+	return loadWith(w, r, "ad spot", get, AdSpotNotFound)
+}
+
+// loadWith fetches the row named by the request's id path value with get,
+// which returns notFound if there is no such row.
+func loadWith[T any](w http.ResponseWriter, r *http.Request, what string, get func(context.Context, string) (T, error), notFound error) (row T, ok bool) {
 	id := r.PathValue("id")
 	if id == "" {
 		JSONError(w, map[string]string{
 			"what": "ID parameter is missing",
 		}, http.StatusBadRequest)
-		return
+		return row, false
 	}
 
-	spots, err := gorm.G[AdSpot](s.db).Where("id = ?", id).Find(r.Context())
+	row, err := get(r.Context(), id)
+	if errors.Is(err, notFound) {
+		JSONError(w, map[string]string{
+			"what": fmt.Sprintf("Could not find %s with requested ID", what),
+			"id":   id,
+		}, http.StatusNotFound)
+		return row, false
+	}
 	if err != nil {
 		JSONError(w, map[string]string{
 			"what":    "Database request failed",
 			"context": err.Error(),
 		}, http.StatusInternalServerError)
+		return row, false
+	}
+
+	return row, true
+}
+
+// ReplaceAdSpot handles PUT, replacing every editable field of the ad spot.
+func (s *Server) ReplaceAdSpot(w http.ResponseWriter, r *http.Request) {
+	spot, ok := s.loadAdSpot(w, r)
+	if !ok || !checkIfMatch(w, r, spot) {
 		return
 	}
 
-	if len(spots) == 0 {
-		JSONError(w, map[string]string{
-			"what": "Could not find ad spot with requested ID",
-			"id":   id,
-		}, http.StatusNotFound)
+	var payload UpdatePayload
+	if !decodeStrict(w, r.Body, &payload) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	e := json.NewEncoder(w)
-	e.Encode(spots[0])
+	s.updateAdSpot(w, r, spot, payload)
 }
 
-func (s *Server) DeactivateAdSpot(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		JSONError(w, map[string]string{
-			"what": "ID parameter is missing",
-		}, http.StatusBadRequest)
+// PatchAdSpot handles PATCH, applying a JSON merge patch (RFC 7396) to the
+// editable fields of the ad spot.
+func (s *Server) PatchAdSpot(w http.ResponseWriter, r *http.Request) {
+	spot, ok := s.loadAdSpot(w, r)
+	if !ok || !checkIfMatch(w, r, spot) {
+		return
+	}
+
+	var payload UpdatePayload
+	if !decodeMergePatch(w, r.Body, spot.payload(), &payload) {
 		return
 	}
 
-	now := ISO8601(time.Now())
-	rows, err := gorm.G[AdSpot](s.db).
-		Where("id = ? AND status = ?", id, true).
-		Updates(r.Context(), AdSpot{Status: StatusInactive, DeactivatedAt: &now})
+	s.updateAdSpot(w, r, spot, payload)
+}
 
+// updateAdSpot validates the payload against the stored ad spot, persists the
+// editable fields and responds with the updated ad spot.
+func (s *Server) updateAdSpot(w http.ResponseWriter, r *http.Request, spot AdSpot, payload UpdatePayload) {
+	place, validationErrors := payload.validate(r.Context(), s.placements, spot)
+	storedErrors, err := s.validateStored(r.Context(), place, payload.CreatePayload)
 	if err != nil {
 		JSONError(w, map[string]string{
-			"what":    "Failed to execute database update",
+			"what":    "Database request failed",
 			"context": err.Error(),
 		}, http.StatusInternalServerError)
 		return
 	}
-
-	if rows == 0 {
-		JSONError(w, map[string]string{
-			"what": "Ad spot was not found, or was already inactive",
+	validationErrors = append(validationErrors, storedErrors...)
+	if len(validationErrors) > 0 {
+		JSONError(w, map[string]any{
+			"what":    "Failed to validate JSON payload",
+			"context": validationErrors,
 		}, http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Ad spot deactivated successfully",
-		"id":      id,
+	spot.apply(payload.CreatePayload, place)
+
+	err = s.writeWithinLimit(r.Context(), spot, func(store AdSpotStore) error {
+		return store.Update(r.Context(), spot)
 	})
+	if errors.Is(err, PlacementFull) {
+		placementFull(w, spot)
+		return
+	}
+	if errors.Is(err, StaleAdSpot) {
+		JSONError(w, map[string]string{
+			"what": "Ad spot was changed concurrently",
+		}, conflictStatus(r))
+		return
+	}
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database update",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	s.invalidate()
+
+	spot.Version++
+	s.writeAdSpot(w, r, spot)
 }
 
 func (s *Server) ListAdSpots(w http.ResponseWriter, r *http.Request) {
 	placement := r.URL.Query().Get("placement")
 	status := r.URL.Query().Get("status")
 
-	query := gorm.G[AdSpot](s.db).Order("created_at desc")
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		JSONError(w, map[string]any{
+			"what":    "Invalid value for limit field",
+			"context": fmt.Sprintf("limit must be between 1 and %d", MaxPageSize),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	sort, err := parseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		JSONError(w, map[string]any{
+			"what":    "Invalid value for sort field",
+			"context": fmt.Sprintf("sort must be %s or %s", SortCreatedAt, SortPriority),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	filter := AdSpotFilter{Sort: sort, Limit: limit + 1, Now: time.Now()}
+
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		var cursor Cursor
+		if err := cursor.Decode(value); err != nil || cursor.sort() != sort {
+			JSONError(w, map[string]string{
+				"what": "Invalid value for cursor field",
+			}, http.StatusBadRequest)
+			return
+		}
+		filter.After = &cursor
+	}
 
 	if placement != "" {
-		var p Placement
-		err := p.Parse(placement)
-		if err != nil {
+		p, ok := s.placements.lookup(r.Context(), placement)
+		if !ok {
 			JSONError(w, map[string]string{
 				"what": "Invalid value for placement field",
 			}, http.StatusBadRequest)
 			return
 		}
-		query = query.Where("placement = ?", p)
+		filter.Placement = &p
+	}
+
+	if campaignID := r.URL.Query().Get("campaignId"); campaignID != "" {
+		filter.CampaignID = &campaignID
 	}
 
-	if status != "" {
-		if status != "active" && status != "inactive" {
+	point, err := parseGeoPoint(r)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Invalid value for lat and lng fields",
+			"context": "lat and lng must be given together, as degrees within range",
+		}, http.StatusBadRequest)
+		return
+	}
+	filter.GeoPoint = point
+
+	// Ad spots of inactive campaigns are neither active nor scheduled
+	if status == string(EffectiveScheduled) {
+		filter.Effective = []EffectiveStatus{EffectiveScheduled}
+		filter.ActiveCampaigns = true
+	} else if status == string(EffectiveExpired) {
+		filter.Effective = []EffectiveStatus{EffectiveExpired}
+	} else if status != "" {
+		var st Status
+		if err := st.Parse(status); err != nil {
 			JSONError(w, map[string]string{
 				"what": "Invalid value for status field",
 			}, http.StatusBadRequest)
 			return
 		}
-		query = query.Where("status = ?", status == "active")
+		filter.Status = &st
+
+		if st == StatusActive {
+			filter.Effective = []EffectiveStatus{EffectiveActive}
+			filter.ActiveCampaigns = true
+		}
 	}
 
-	rows, err := query.Find(r.Context())
+	rows, err := s.store.List(r.Context(), filter)
 	if err != nil {
 		JSONError(w, map[string]string{
 			"what":    "Failed to execute database query",
@@ -174,14 +331,22 @@ func (s *Server) ListAdSpots(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rowsFiltered := slices.DeleteFunc(
-		rows,
-		func(a AdSpot) bool {
-			return status == "active" && a.IsExpired()
-		},
-	)
+	s.namePlacements(r.Context(), rows)
+
+	var response ListResponse
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		next := cursorAfter(last, sort).Encode()
+		response.NextCursor = &next
+	}
+
+	response.Data = rows
+	if response.Data == nil {
+		response.Data = []AdSpot{}
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	e := json.NewEncoder(w)
-	e.Encode(rowsFiltered)
+	e.Encode(response)
 }
@@ -0,0 +1,264 @@
+package adspots
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+	_ "time/tzdata" // Schedules may name any IANA timezone
+)
+
+type (
+	// Schedule restricts an ad spot to recurring weekly windows, evaluated in
+	// the schedule's timezone.
+	Schedule struct {
+		Timezone string           `json:"timezone"`
+		Windows  []ScheduleWindow `json:"windows"`
+	}
+	// ScheduleWindow is live on the given days, from Start until End. Times are
+	// written as HH:MM, and End may be 24:00 to run until midnight. A window
+	// ending before it starts runs past midnight, until End on the next day.
+	ScheduleWindow struct {
+		Days  []string `json:"days"`
+		Start string   `json:"start"`
+		End   string   `json:"end"`
+	}
+
+	// LiveWindow is a concrete period during which an ad spot can be served.
+	LiveWindow struct {
+		Start ISO8601 `json:"start"`
+		End   ISO8601 `json:"end"`
+	}
+)
+
+// The preview defaults to the coming week, and spans at most a month.
+const (
+	defaultPreviewSpan = 7 * 24 * time.Hour
+	maxPreviewSpan     = 31 * 24 * time.Hour
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseClock converts an HH:MM time to minutes since midnight.
+func parseClock(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%2d:%2d", &hours, &minutes); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("%q is not formatted as HH:MM", value)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("%q is not a valid time of day", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+func (sc Schedule) validate() []string {
+	var validationErrors []string
+	if _, err := time.LoadLocation(sc.Timezone); sc.Timezone == "" || err != nil {
+		validationErrors = append(validationErrors, "Schedule timezone must be a valid IANA timezone")
+	}
+	if len(sc.Windows) == 0 {
+		validationErrors = append(validationErrors, "Schedule must have at least one window")
+	}
+
+	for i, window := range sc.Windows {
+		if len(window.Days) == 0 {
+			validationErrors = append(validationErrors, fmt.Sprintf("Schedule window %d must have at least one day", i))
+		}
+		for _, day := range window.Days {
+			if _, ok := weekdays[day]; !ok {
+				validationErrors = append(validationErrors, fmt.Sprintf("Schedule window %d has an invalid day %q", i, day))
+			}
+		}
+
+		start, startErr := parseClock(window.Start)
+		end, endErr := parseClock(window.End)
+		for _, err := range []error{startErr, endErr} {
+			if err != nil {
+				validationErrors = append(validationErrors, fmt.Sprintf("Schedule window %d: %s", i, err))
+			}
+		}
+		if startErr == nil && endErr == nil && (start == end || start == 24*60) {
+			validationErrors = append(validationErrors, fmt.Sprintf("Schedule window %d must start before midnight, at a different time than it ends", i))
+		}
+	}
+	return validationErrors
+}
+
+// location returns the schedule's timezone, which was checked on validation.
+func (sc Schedule) location() *time.Location {
+	loc, err := time.LoadLocation(sc.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// activeAt reports whether the instant falls within one of the windows.
+func (sc Schedule) activeAt(t time.Time) bool {
+	local := t.In(sc.location())
+	minute := local.Hour()*60 + local.Minute()
+	yesterday := (local.Weekday() + 6) % 7
+	for _, window := range sc.Windows {
+		start, _ := parseClock(window.Start)
+		end, _ := parseClock(window.End)
+
+		var active bool
+		if start < end {
+			active = minute >= start && minute < end && window.on(local.Weekday())
+		} else {
+			// Windows running past midnight started either today or yesterday
+			active = (minute >= start && window.on(local.Weekday())) || (minute < end && window.on(yesterday))
+		}
+		if active {
+			return true
+		}
+	}
+	return false
+}
+
+// on reports whether the window starts on the given day of the week.
+func (sw ScheduleWindow) on(weekday time.Weekday) bool {
+	return slices.ContainsFunc(sw.Days, func(d string) bool { return weekdays[d] == weekday })
+}
+
+// windows lists the concrete periods covered by the schedule between from
+// and to, merging those that touch.
+func (sc Schedule) windows(from, to time.Time) []LiveWindow {
+	loc := sc.location()
+	var live []LiveWindow
+
+	// Windows running past midnight may have started the day before from
+	first := from.In(loc).AddDate(0, 0, -1)
+	for day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, window := range sc.Windows {
+			if !window.on(day.Weekday()) {
+				continue
+			}
+
+			start, _ := parseClock(window.Start)
+			end, _ := parseClock(window.End)
+			endDay := day
+			if end <= start {
+				endDay = day.AddDate(0, 0, 1)
+			}
+			live = append(live, LiveWindow{
+				Start: ISO8601(time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, loc)),
+				End:   ISO8601(time.Date(endDay.Year(), endDay.Month(), endDay.Day(), end/60, end%60, 0, 0, loc)),
+			})
+		}
+	}
+
+	return clipWindows(live, from, to)
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// clipWindows sorts the windows, merges the overlapping ones and trims them
+// to the given range, dropping those left empty.
+func clipWindows(windows []LiveWindow, from, to time.Time) []LiveWindow {
+	slices.SortFunc(windows, func(a, b LiveWindow) int {
+		return time.Time(a.Start).Compare(time.Time(b.Start))
+	})
+
+	clipped := []LiveWindow{}
+	for _, window := range windows {
+		start := latest(time.Time(window.Start), from)
+		end := earliest(time.Time(window.End), to)
+		if !start.Before(end) {
+			continue
+		}
+
+		if n := len(clipped); n > 0 && !start.After(time.Time(clipped[n-1].End)) {
+			clipped[n-1].End = ISO8601(latest(end, time.Time(clipped[n-1].End)))
+			continue
+		}
+		clipped = append(clipped, LiveWindow{Start: ISO8601(start), End: ISO8601(end)})
+	}
+	return clipped
+}
+
+// liveWindows lists the periods between from and to during which the ad
+// spot's flight, expiry date and schedule all allow it to be served.
+func (a AdSpot) liveWindows(from, to time.Time) []LiveWindow {
+	if a.StartAt != nil {
+		from = latest(from, time.Time(*a.StartAt))
+	}
+	if expiresAt := a.expiry(); expiresAt != nil {
+		to = earliest(to, time.Time(*expiresAt))
+	}
+
+	if a.Schedule == nil {
+		return clipWindows([]LiveWindow{{Start: ISO8601(from), End: ISO8601(to)}}, from, to)
+	}
+	return a.Schedule.windows(from, to)
+}
+
+// PreviewSchedule lists the upcoming periods during which the ad spot will be
+// live, ignoring its status.
+func (s *Server) PreviewSchedule(w http.ResponseWriter, r *http.Request) {
+	spot, ok := s.loadAdSpot(w, r)
+	if !ok {
+		return
+	}
+
+	from := time.Now()
+	if value := r.URL.Query().Get("from"); value != "" {
+		var tm ISO8601
+		if err := tm.Parse(value); err != nil {
+			JSONError(w, map[string]string{
+				"what":    "Invalid value for from field",
+				"context": err.Error(),
+			}, http.StatusBadRequest)
+			return
+		}
+		from = time.Time(tm)
+	}
+
+	to := from.Add(defaultPreviewSpan)
+	if value := r.URL.Query().Get("to"); value != "" {
+		var tm ISO8601
+		if err := tm.Parse(value); err != nil {
+			JSONError(w, map[string]string{
+				"what":    "Invalid value for to field",
+				"context": err.Error(),
+			}, http.StatusBadRequest)
+			return
+		}
+		to = time.Time(tm)
+	}
+
+	if !from.Before(to) || to.Sub(from) > maxPreviewSpan {
+		JSONError(w, map[string]string{
+			"what":    "Invalid preview range",
+			"context": fmt.Sprintf("from must be before to, and at most %d days apart", maxPreviewSpan/(24*time.Hour)),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	JSONResponse(w, map[string]any{
+		"adSpotId": spot.ID,
+		"from":     ISO8601(from),
+		"to":       ISO8601(to),
+		"windows":  spot.liveWindows(from, to),
+	}, http.StatusOK)
+}
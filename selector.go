@@ -0,0 +1,114 @@
+package adspots
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+// Selector picks the ad spot to serve among the eligible candidates for a
+// placement. Candidates are never empty, all share the highest priority
+// among the eligible ad spots, and are always passed in the same order for a
+// given set of ad spots.
+type Selector interface {
+	Select(placement Placement, candidates []AdSpot) AdSpot
+}
+
+var InvalidSelector = errors.New("invalid selection strategy")
+
+// RandomSelector picks uniformly among the candidates, ignoring their weight.
+type RandomSelector struct{}
+
+// RoundRobinSelector cycles through the candidates of each placement,
+// ignoring their weight.
+type RoundRobinSelector struct {
+	mu   sync.Mutex
+	next map[Placement]int
+}
+
+// WeightedSelector picks candidates with a probability proportional to their
+// weight, which defaults to the ad spot's Weight field. Candidates with a
+// weight of zero or less are never picked, unless none of them have a
+// positive weight.
+type WeightedSelector struct {
+	Weight func(AdSpot) int
+}
+
+// ParseSelector returns the selection strategy with the given name. A non-zero
+// seed makes the thompson strategy deterministic, and is ignored otherwise.
+func ParseSelector(name string, seed uint64) (Selector, error) {
+	switch name {
+	case "random":
+		return RandomSelector{}, nil
+	case "round_robin":
+		return NewRoundRobinSelector(), nil
+	case "weighted":
+		return WeightedSelector{}, nil
+	case "thompson":
+		if seed == 0 {
+			seed = rand.Uint64()
+		}
+		return NewThompsonSelector(seed), nil
+	}
+	return nil, InvalidSelector
+}
+
+func (RandomSelector) Select(_ Placement, candidates []AdSpot) AdSpot {
+	return candidates[rand.IntN(len(candidates))]
+}
+
+func NewRoundRobinSelector() *RoundRobinSelector {
+	return &RoundRobinSelector{
+		next: make(map[Placement]int),
+	}
+}
+
+func (rr *RoundRobinSelector) Select(placement Placement, candidates []AdSpot) AdSpot {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	i := rr.next[placement] % len(candidates)
+	rr.next[placement] = i + 1
+	return candidates[i]
+}
+
+func (ws WeightedSelector) Select(_ Placement, candidates []AdSpot) AdSpot {
+	weight := ws.Weight
+	if weight == nil {
+		weight = func(a AdSpot) int { return a.Weight }
+	}
+
+	total := 0
+	for _, spot := range candidates {
+		total += max(weight(spot), 0)
+	}
+	if total == 0 {
+		return candidates[rand.IntN(len(candidates))]
+	}
+
+	n := rand.IntN(total)
+	for _, spot := range candidates {
+		n -= max(weight(spot), 0)
+		if n < 0 {
+			return spot
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// topPriority keeps the candidates sharing the highest priority, which are
+// the only ones that may be served.
+func topPriority(candidates []AdSpot) []AdSpot {
+	if len(candidates) == 0 {
+		return candidates
+	}
+
+	highest := candidates[0].Priority
+	for _, spot := range candidates[1:] {
+		highest = max(highest, spot.Priority)
+	}
+	return slices.DeleteFunc(candidates, func(a AdSpot) bool {
+		return a.Priority < highest
+	})
+}
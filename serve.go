@@ -0,0 +1,180 @@
+package adspots
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// eligibleCacheTTL bounds how stale the cached candidates can get when the
+// database is written to by something other than this server.
+const eligibleCacheTTL = 5 * time.Second
+
+// eligibleCache keeps the active ad spots of each placement in memory, so
+// that serving an ad doesn't need a database round trip. Its generation is
+// bumped on every invalidation, so that a load racing with a write isn't
+// cached.
+type eligibleCache struct {
+	mu         sync.RWMutex
+	ttl        time.Duration
+	entries    map[Placement]eligibleEntry
+	generation uint64
+}
+
+type eligibleEntry struct {
+	spots    []AdSpot
+	loadedAt time.Time
+}
+
+func newEligibleCache(ttl time.Duration) *eligibleCache {
+	return &eligibleCache{
+		ttl:     ttl,
+		entries: make(map[Placement]eligibleEntry),
+	}
+}
+
+// get returns the cached candidates for the placement, calling load if they
+// are missing or stale. What load returns is only cached if nothing was
+// invalidated meanwhile, since it may predate the write.
+func (c *eligibleCache) get(ctx context.Context, placement Placement, load func(context.Context, Placement) ([]AdSpot, error)) ([]AdSpot, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[placement]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if ok && time.Since(entry.loadedAt) < c.ttl {
+		return entry.spots, nil
+	}
+
+	spots, err := load(ctx, placement)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.entries[placement] = eligibleEntry{spots: spots, loadedAt: time.Now()}
+	}
+	c.mu.Unlock()
+
+	return spots, nil
+}
+
+// invalidate drops every cached placement. It is called whenever an ad spot
+// is written to, since the write may change which placements it belongs to.
+func (c *eligibleCache) invalidate() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.generation++
+	c.mu.Unlock()
+}
+
+// invalidate drops everything cached about ad spots. It is called whenever
+// an ad spot is written to.
+func (s *Server) invalidate() {
+	s.cache.invalidate()
+	s.geo.invalidate()
+}
+
+// SetSelector changes the selection strategy used by the serving endpoint.
+// It must be called before the server starts handling requests.
+func (s *Server) SetSelector(selector Selector) {
+	s.selector = selector
+}
+
+// loadEligible fetches the active, unexpired ad spots of a placement whose
+// campaign is active, including those whose flight has yet to start.
+func (s *Server) loadEligible(ctx context.Context, placement Placement) ([]AdSpot, error) {
+	return s.store.List(ctx, AdSpotFilter{
+		Placement:       &placement,
+		Effective:       []EffectiveStatus{EffectiveActive, EffectiveScheduled},
+		ActiveCampaigns: true,
+	})
+}
+
+// ServeAdSpot picks one eligible ad spot for the requested placement. It
+// answers with 204 No Content when there is nothing to show. The optional
+// clientId parameter is needed to serve frequency capped ad spots, the
+// optional lat and lng parameters to serve geo targeted ad spots, and the
+// ctx.* parameters are matched against targeting expressions. Ad spots with
+// creatives are served with the creative assigned to the client.
+func (s *Server) ServeAdSpot(w http.ResponseWriter, r *http.Request) {
+	placement, ok := s.placements.lookup(r.Context(), r.URL.Query().Get("placement"))
+	if !ok {
+		JSONError(w, map[string]string{
+			"what": "Invalid value for placement field",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	point, err := parseGeoPoint(r)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Invalid value for lat and lng fields",
+			"context": "lat and lng must be given together, as degrees within range",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	spots, err := s.cache.get(r.Context(), placement, s.loadEligible)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	// Cached candidates may have expired, started or left their schedule's
+	// windows since they were loaded
+	attributes := parseTargetingContext(r)
+	candidates := slices.DeleteFunc(slices.Clone(spots), func(a AdSpot) bool {
+		return !a.IsLive() || (a.Targeting != nil && !a.Targeting.matches(attributes))
+	})
+
+	candidates, err = s.withinGeo(r.Context(), candidates, point)
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	candidates, err = s.withoutCapped(r.Context(), candidates, r.URL.Query().Get("clientId"), time.Now())
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	candidates, err = s.withinBudget(r.Context(), candidates, time.Now())
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	if len(candidates) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	selected, err := s.selectAdSpot(r.Context(), placement, topPriority(candidates))
+	if err != nil {
+		JSONError(w, map[string]string{
+			"what":    "Failed to execute database query",
+			"context": err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	served := []AdSpot{selected.withCreative(r.URL.Query().Get("clientId"))}
+	s.namePlacements(r.Context(), served)
+	JSONResponse(w, served[0], http.StatusOK)
+}
@@ -0,0 +1,233 @@
+package adspots
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SQLStore stores ad spots with database/sql, in the same ad_spots table as
+// GormStore.
+type SQLStore struct {
+	db     sqlConn
+	driver string
+}
+
+// sqlConn is what SQLStore needs of a database, which transactions offer too.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// NewSQLStore returns a store writing queries for the named driver, one of
+// DriverSQLite and DriverPostgres.
+func NewSQLStore(db *sql.DB, driver string) *SQLStore {
+	return &SQLStore{db: db, driver: driver}
+}
+
+// adSpotColumns lists the stored columns of AdSpot, in the order scanAdSpot
+// and adSpotValues use. scanAdSpot reads CampaignInactive last.
+var adSpotColumns = []string{
+	"id", "title", "image_url", "image_size", "placement", "campaign_id", "priority", "weight",
+	"status", "ttl_minutes", "created_at", "deactivated_at", "deactivation_reason",
+	"expires_at", "max_impressions", "frequency_cap", "start_at", "end_at",
+	"schedule", "geo", "geo_south", "geo_west", "geo_north", "geo_east", "targeting", "creatives", "version",
+}
+
+// jsonColumn stores a value as JSON, and nil as NULL, like gorm's json
+// serializer. V must be a pointer when scanning.
+type jsonColumn struct {
+	V any
+}
+
+func (jc jsonColumn) Value() (driver.Value, error) {
+	buf, err := json.Marshal(jc.V)
+	if err != nil || string(buf) == "null" {
+		return nil, err
+	}
+	return string(buf), nil
+}
+
+func (jc jsonColumn) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), jc.V)
+	case []byte:
+		return json.Unmarshal(v, jc.V)
+	}
+	return fmt.Errorf("cannot scan %T into JSON", value)
+}
+
+func adSpotValues(a *AdSpot) []any {
+	var bounds struct{ South, West, North, East *float64 }
+	if a.GeoBounds != nil {
+		bounds.South, bounds.West, bounds.North, bounds.East = &a.GeoBounds.South, &a.GeoBounds.West, &a.GeoBounds.North, &a.GeoBounds.East
+	}
+	return []any{
+		a.ID, a.Title, a.ImageURL, jsonColumn{a.ImageSize}, a.Placement, a.CampaignID, a.Priority, a.Weight,
+		a.Status, a.TTLMinutes, a.CreatedAt, a.DeactivatedAt, string(a.DeactivationReason),
+		a.ExpiresAt, a.MaxImpressions, jsonColumn{a.FrequencyCap}, a.StartAt, a.EndAt,
+		jsonColumn{a.Schedule}, jsonColumn{a.Geo}, bounds.South, bounds.West, bounds.North, bounds.East,
+		jsonColumn{a.Targeting}, jsonColumn{a.Creatives}, a.Version,
+	}
+}
+
+func scanAdSpot(rows *sql.Rows) (AdSpot, error) {
+	var a AdSpot
+	var reason sql.NullString
+	var south, west, north, east sql.NullFloat64
+	err := rows.Scan(
+		&a.ID, &a.Title, &a.ImageURL, jsonColumn{&a.ImageSize}, &a.Placement, &a.CampaignID, &a.Priority, &a.Weight,
+		&a.Status, &a.TTLMinutes, &a.CreatedAt, &a.DeactivatedAt, &reason,
+		&a.ExpiresAt, &a.MaxImpressions, jsonColumn{&a.FrequencyCap}, &a.StartAt, &a.EndAt,
+		jsonColumn{&a.Schedule}, jsonColumn{&a.Geo}, &south, &west, &north, &east,
+		jsonColumn{&a.Targeting}, jsonColumn{&a.Creatives}, &a.Version, &a.CampaignInactive,
+	)
+	a.DeactivationReason = DeactivationReason(reason.String)
+	if south.Valid && west.Valid && north.Valid && east.Valid {
+		a.GeoBounds = &GeoBounds{South: south.Float64, West: west.Float64, North: north.Float64, East: east.Float64}
+	}
+	return a, err
+}
+
+func (ss *SQLStore) Create(ctx context.Context, spot AdSpot) error {
+	spot.derive()
+	spot.Version = 1
+	query := fmt.Sprintf("INSERT INTO ad_spots (%s) VALUES %s", strings.Join(adSpotColumns, ", "), placeholders(len(adSpotColumns)))
+	_, err := ss.db.ExecContext(ctx, rebind(ss.driver, query), adSpotValues(&spot)...)
+	return err
+}
+
+func (ss *SQLStore) Get(ctx context.Context, id string) (AdSpot, error) {
+	spots, err := ss.List(ctx, AdSpotFilter{IDs: []string{id}})
+	if err != nil {
+		return AdSpot{}, err
+	}
+	if len(spots) == 0 {
+		return AdSpot{}, AdSpotNotFound
+	}
+	return spots[0], nil
+}
+
+func (ss *SQLStore) Update(ctx context.Context, spot AdSpot) error {
+	values := adSpotValues(&spot)
+	assignments := []string{"version = version + 1"}
+	var args []any
+	for i, column := range adSpotColumns {
+		if slices.Contains(editableColumns, column) {
+			assignments = append(assignments, column+" = ?")
+			args = append(args, values[i])
+		}
+	}
+
+	query := fmt.Sprintf("UPDATE ad_spots SET %s WHERE id = ? AND version = ?", strings.Join(assignments, ", "))
+	result, err := ss.db.ExecContext(ctx, rebind(ss.driver, query), append(args, spot.ID, spot.Version)...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ss.stale(ctx, spot.ID)
+	}
+	return nil
+}
+
+// stale tells why an ad spot wasn't updated: either it doesn't exist, or its
+// version moved on.
+func (ss *SQLStore) stale(ctx context.Context, id string) error {
+	if _, err := ss.Get(ctx, id); err != nil {
+		return err
+	}
+	return StaleAdSpot
+}
+
+func (ss *SQLStore) UpdateStatus(ctx context.Context, spot AdSpot, from Status) (bool, error) {
+	result, err := ss.db.ExecContext(ctx, rebind(ss.driver,
+		"UPDATE ad_spots SET status = ?, deactivated_at = ?, deactivation_reason = ?, version = version + 1 WHERE id = ? AND status = ? AND version = ?"),
+		spot.Status, spot.DeactivatedAt, string(spot.DeactivationReason), spot.ID, from, spot.Version,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (ss *SQLStore) List(ctx context.Context, filter AdSpotFilter) ([]AdSpot, error) {
+	return listExact(filter, func(filter AdSpotFilter) ([]AdSpot, error) {
+		return ss.list(ctx, filter)
+	})
+}
+
+func (ss *SQLStore) list(ctx context.Context, filter AdSpotFilter) ([]AdSpot, error) {
+	query := fmt.Sprintf("SELECT %s, %s FROM ad_spots", strings.Join(adSpotColumns, ", "), campaignInactive)
+	args := []any{StatusActive}
+	if cond, condArgs := filter.conditions(); cond != "" {
+		query += " WHERE " + cond
+		args = append(args, condArgs...)
+	}
+	query += " ORDER BY " + orderClause(filter.Sort)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := ss.db.QueryContext(ctx, rebind(ss.driver, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spots []AdSpot
+	for rows.Next() {
+		spot, err := scanAdSpot(rows)
+		if err != nil {
+			return nil, err
+		}
+		spots = append(spots, spot)
+	}
+	return spots, rows.Err()
+}
+
+func (ss *SQLStore) DeactivateExpired(ctx context.Context, now time.Time) (int, error) {
+	result, err := ss.db.ExecContext(ctx, rebind(ss.driver,
+		"UPDATE ad_spots SET status = ?, deactivated_at = expires_at, deactivation_reason = ?, version = version + 1 WHERE status IN (?, ?) AND expires_at < ?"),
+		StatusDeactivated, string(DeactivationTTLExpired), StatusActive, StatusPaused, ISO8601(now),
+	)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
+
+// Transaction runs fn within the current transaction if there is one, since
+// database/sql can't begin a transaction within another.
+func (ss *SQLStore) Transaction(ctx context.Context, placement Placement, fn func(AdSpotStore) error) error {
+	db, ok := ss.db.(*sql.DB)
+	if !ok {
+		return fn(ss)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, rebind(ss.driver, lockPlacement), placement); err != nil {
+		return err
+	}
+	if err := fn(&SQLStore{db: tx, driver: ss.driver}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
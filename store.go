@@ -0,0 +1,394 @@
+package adspots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AdSpotStore persists ad spots. Implementations must be safe for concurrent
+// use, and must behave alike: t/store_test.go holds the test suite every one
+// of them has to pass.
+type AdSpotStore interface {
+	// Create stores a new ad spot at version 1, failing if its ID is taken.
+	Create(ctx context.Context, spot AdSpot) error
+	// Get returns the ad spot with the given ID, or AdSpotNotFound. Like
+	// List, it sets CampaignInactive from the campaigns table.
+	Get(ctx context.Context, id string) (AdSpot, error)
+	// Update overwrites the editable fields of the ad spot, leaving its
+	// status and creation date alone, and bumps its version. It returns
+	// AdSpotNotFound if the ad spot doesn't exist, and StaleAdSpot if its
+	// stored version is no longer spot.Version.
+	Update(ctx context.Context, spot AdSpot) error
+	// UpdateStatus stores the ad spot's status, deactivation date and
+	// deactivation reason and bumps its version, but only if its stored
+	// status is still from and its stored version still spot.Version. It
+	// reports whether the ad spot was updated.
+	UpdateStatus(ctx context.Context, spot AdSpot, from Status) (bool, error)
+	// List returns the ad spots matching the filter, in its sort order.
+	List(ctx context.Context, filter AdSpotFilter) ([]AdSpot, error)
+	// DeactivateExpired deactivates every active or paused ad spot that
+	// expired before now, back-dating DeactivatedAt to the moment it expired
+	// and bumping its version. It returns the number of ad spots deactivated.
+	DeactivateExpired(ctx context.Context, now time.Time) (int, error)
+	// Transaction calls fn with a store whose reads and writes happen in one
+	// transaction, committed if fn returns nil. Transactions for the same
+	// placement run one at a time, so that fn can count the placement's ad
+	// spots before writing one.
+	Transaction(ctx context.Context, placement Placement, fn func(AdSpotStore) error) error
+}
+
+// Store persists everything a server keeps: ad spots, campaigns, events,
+// placements and idempotent responses.
+type Store interface {
+	AdSpotStore
+	CampaignStore
+	EventStore
+	PlacementStore
+	IdempotencyStore
+}
+
+// WithAdSpots returns a store keeping its ad spots in spots, and everything
+// else in store.
+func WithAdSpots(store Store, spots AdSpotStore) Store {
+	return adSpotsStore{Store: store, spots: spots}
+}
+
+type adSpotsStore struct {
+	Store
+	spots AdSpotStore
+}
+
+func (as adSpotsStore) Create(ctx context.Context, spot AdSpot) error {
+	return as.spots.Create(ctx, spot)
+}
+
+func (as adSpotsStore) Get(ctx context.Context, id string) (AdSpot, error) {
+	return as.spots.Get(ctx, id)
+}
+
+func (as adSpotsStore) Update(ctx context.Context, spot AdSpot) error {
+	return as.spots.Update(ctx, spot)
+}
+
+func (as adSpotsStore) UpdateStatus(ctx context.Context, spot AdSpot, from Status) (bool, error) {
+	return as.spots.UpdateStatus(ctx, spot, from)
+}
+
+func (as adSpotsStore) List(ctx context.Context, filter AdSpotFilter) ([]AdSpot, error) {
+	return as.spots.List(ctx, filter)
+}
+
+func (as adSpotsStore) DeactivateExpired(ctx context.Context, now time.Time) (int, error) {
+	return as.spots.DeactivateExpired(ctx, now)
+}
+
+func (as adSpotsStore) Transaction(ctx context.Context, placement Placement, fn func(AdSpotStore) error) error {
+	return as.spots.Transaction(ctx, placement, fn)
+}
+
+// inactiveCampaigns selects the IDs of the campaigns that aren't active,
+// given StatusActive. campaignInactive reads CampaignInactive with it.
+const (
+	inactiveCampaigns = "SELECT id FROM campaigns WHERE status <> ?"
+	campaignInactive  = "(campaign_id IS NOT NULL AND campaign_id IN (" + inactiveCampaigns + ")) AS campaign_inactive"
+)
+
+// lockPlacement is a write that changes nothing, made first in transactions
+// to hold a lock on the placement until they end. SQLite locks the whole
+// database instead.
+const lockPlacement = "UPDATE placements SET id = id WHERE id = ?"
+
+// AdSpotFilter selects the ad spots returned by AdSpotStore.List. The zero
+// value selects every ad spot, newest first.
+type AdSpotFilter struct {
+	// IDs, if not empty, keeps the ad spots with one of these IDs.
+	IDs        []string
+	Placement  *Placement
+	CampaignID *string
+	Status     *Status
+	// Effective, if not empty, keeps the ad spots whose effective status at
+	// Now is one of these, regardless of their campaign.
+	Effective []EffectiveStatus
+	Now       time.Time
+	// ActiveCampaigns drops the ad spots whose campaign isn't active.
+	ActiveCampaigns bool
+	// GeoTargeted keeps only the ad spots with geo targeting.
+	GeoTargeted bool
+	// GeoPoint, if not nil, drops the geo targeted ad spots whose area
+	// doesn't contain it.
+	GeoPoint *GeoPoint
+
+	Sort  string
+	After *Cursor
+	// Limit caps the number of ad spots returned, if positive.
+	Limit int
+}
+
+var AdSpotNotFound = errors.New("ad spot not found")
+var StaleAdSpot = errors.New("ad spot was changed since it was read")
+
+// conditions translates the filter into a SQL condition on the ad_spots
+// table, along with its arguments. It is shared by the SQL stores.
+func (f AdSpotFilter) conditions() (string, []any) {
+	var conds []string
+	var args []any
+	where := func(cond string, values ...any) {
+		conds = append(conds, "("+cond+")")
+		args = append(args, values...)
+	}
+
+	if len(f.IDs) > 0 {
+		where("id IN "+placeholders(len(f.IDs)), anySlice(f.IDs)...)
+	}
+	if f.Placement != nil {
+		where("placement = ?", *f.Placement)
+	}
+	if f.CampaignID != nil {
+		where("campaign_id = ?", *f.CampaignID)
+	}
+	if f.Status != nil {
+		where("status = ?", *f.Status)
+	}
+	if len(f.Effective) > 0 {
+		var effective []string
+		for _, status := range f.Effective {
+			cond, values := effectiveCondition(status, f.now())
+			effective = append(effective, "("+cond+")")
+			args = append(args, values...)
+		}
+		conds = append(conds, "("+strings.Join(effective, " OR ")+")")
+	}
+	if f.ActiveCampaigns {
+		where("campaign_id IS NULL OR campaign_id NOT IN ("+inactiveCampaigns+")", StatusActive)
+	}
+	if f.GeoTargeted {
+		where("geo IS NOT NULL")
+	}
+	if f.GeoPoint != nil {
+		// Only the bounding box is tested here, and ad spots written before
+		// it was stored lack one
+		where("geo IS NULL OR geo_south IS NULL OR (geo_south <= ? AND geo_north >= ? AND geo_west <= ? AND geo_east >= ?)",
+			f.GeoPoint.Lat, f.GeoPoint.Lat, f.GeoPoint.Lng, f.GeoPoint.Lng)
+	}
+	if f.After != nil {
+		cond, values := f.After.condition()
+		where(cond, values...)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// effectiveCondition translates an effective status into a SQL condition,
+// following AdSpot.EffectiveStatus. Weekly schedules can't be evaluated in
+// SQL, so the active and scheduled conditions both keep the ad spots that
+// have one, and listExact sorts them out.
+func effectiveCondition(status EffectiveStatus, now time.Time) (string, []any) {
+	const (
+		active    = "COALESCE(status, '') = ? AND (expires_at IS NULL OR expires_at >= ?) AND (start_at IS NULL OR start_at <= ?)"
+		scheduled = "COALESCE(status, '') = ? AND (expires_at IS NULL OR expires_at >= ?) AND ((start_at IS NOT NULL AND start_at > ?) OR schedule IS NOT NULL)"
+		expired   = "expires_at IS NOT NULL AND expires_at < ? AND (COALESCE(status, '') IN (?, ?) OR (COALESCE(status, '') = ? AND COALESCE(deactivation_reason, '') = ?))"
+	)
+	at := ISO8601(now)
+	activeArgs := []any{StatusActive, at, at}
+	scheduledArgs := []any{StatusActive, at, at}
+	expiredArgs := []any{at, StatusActive, StatusPaused, StatusDeactivated, DeactivationTTLExpired}
+
+	switch status {
+	case EffectiveActive:
+		return active, activeArgs
+	case EffectiveScheduled:
+		return scheduled, scheduledArgs
+	case EffectiveExpired:
+		return expired, expiredArgs
+	}
+	// Negating the conditions above keeps the remaining ad spots only if
+	// they are never NULL, so nullable dates are tested with IS NULL and
+	// nullable text is coalesced, as older rows may lack a deactivation reason
+	return fmt.Sprintf("NOT ((%s) OR (%s) OR (%s))", active, scheduled, expired),
+		slices.Concat(activeArgs, scheduledArgs, expiredArgs)
+}
+
+// checksSchedules reports whether the filter tells active ad spots from
+// scheduled ones, which depends on weekly schedules.
+func (f AdSpotFilter) checksSchedules() bool {
+	return slices.Contains(f.Effective, EffectiveActive) != slices.Contains(f.Effective, EffectiveScheduled)
+}
+
+// recheck reports whether the ad spot passes the parts of the filter that
+// its SQL condition only approximates: weekly schedules and geo targets.
+func (f AdSpotFilter) recheck(spot AdSpot) bool {
+	if f.checksSchedules() && !slices.Contains(f.Effective, spot.ownStatusAt(f.now().Truncate(time.Second))) {
+		return false
+	}
+	return f.GeoPoint == nil || spot.Geo == nil || spot.Geo.contains(*f.GeoPoint)
+}
+
+// listExact calls list with the filter, dropping the ad spots its SQL
+// condition kept but recheck doesn't. Further pages are listed until the
+// limit is met.
+func listExact(filter AdSpotFilter, list func(AdSpotFilter) ([]AdSpot, error)) ([]AdSpot, error) {
+	if !filter.checksSchedules() && filter.GeoPoint == nil {
+		return list(filter)
+	}
+
+	filter.Now = filter.now()
+	var spots []AdSpot
+	for {
+		page, err := list(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, spot := range page {
+			if filter.recheck(spot) {
+				spots = append(spots, spot)
+			}
+		}
+		if filter.Limit <= 0 || len(page) < filter.Limit || len(spots) >= filter.Limit {
+			break
+		}
+		cursor := cursorAfter(page[len(page)-1], filter.Sort)
+		filter.After = &cursor
+	}
+
+	if filter.Limit > 0 && len(spots) > filter.Limit {
+		spots = spots[:filter.Limit]
+	}
+	return spots, nil
+}
+
+func (f AdSpotFilter) now() time.Time {
+	if f.Now.IsZero() {
+		return time.Now()
+	}
+	return f.Now
+}
+
+// placeholders returns a parenthesized list of n placeholders, for IN.
+func placeholders(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+func anySlice[T any](values []T) []any {
+	result := make([]any, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
+// bumped returns the ad spot at its next version, as stores write it.
+func (a AdSpot) bumped() AdSpot {
+	a.Version++
+	return a
+}
+
+// GormStore stores ad spots, and everything else a server keeps, with gorm.
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (gs *GormStore) Create(ctx context.Context, spot AdSpot) error {
+	spot.Version = 1
+	return gorm.G[AdSpot](gs.db).Create(ctx, &spot)
+}
+
+func (gs *GormStore) Get(ctx context.Context, id string) (AdSpot, error) {
+	rows, err := gs.adSpots().Where("id = ?", id).Find(ctx)
+	if err != nil {
+		return AdSpot{}, err
+	}
+	if len(rows) == 0 {
+		return AdSpot{}, AdSpotNotFound
+	}
+	return rows[0], nil
+}
+
+// adSpots queries the ad spots along with whether their campaign is active.
+func (gs *GormStore) adSpots() gorm.ChainInterface[AdSpot] {
+	return gorm.G[AdSpot](gs.db).Select("ad_spots.*, "+campaignInactive, StatusActive)
+}
+
+// first returns the row with the given ID, or notFound if there is none.
+func first[T any](ctx context.Context, db *gorm.DB, id string, notFound error) (T, error) {
+	var row T
+	rows, err := gorm.G[T](db).Where("id = ?", id).Find(ctx)
+	if err != nil {
+		return row, err
+	}
+	if len(rows) == 0 {
+		return row, notFound
+	}
+	return rows[0], nil
+}
+
+func (gs *GormStore) Update(ctx context.Context, spot AdSpot) error {
+	rows, err := gorm.G[AdSpot](gs.db).
+		Where("id = ? AND version = ?", spot.ID, spot.Version).
+		Select("version", editableColumns).
+		Updates(ctx, spot.bumped())
+	if err == nil && rows == 0 {
+		return gs.stale(ctx, spot.ID)
+	}
+	return err
+}
+
+// stale tells why an ad spot wasn't updated: either it doesn't exist, or its
+// version moved on.
+func (gs *GormStore) stale(ctx context.Context, id string) error {
+	if _, err := gs.Get(ctx, id); err != nil {
+		return err
+	}
+	return StaleAdSpot
+}
+
+func (gs *GormStore) UpdateStatus(ctx context.Context, spot AdSpot, from Status) (bool, error) {
+	rows, err := gorm.G[AdSpot](gs.db).
+		Where("id = ? AND status = ? AND version = ?", spot.ID, from, spot.Version).
+		Select("status", "deactivated_at", "deactivation_reason", "version").
+		Updates(ctx, spot.bumped())
+	return rows > 0, err
+}
+
+func (gs *GormStore) List(ctx context.Context, filter AdSpotFilter) ([]AdSpot, error) {
+	return listExact(filter, func(filter AdSpotFilter) ([]AdSpot, error) {
+		query := gs.adSpots().Order(orderClause(filter.Sort))
+		if cond, args := filter.conditions(); cond != "" {
+			query = query.Where(cond, args...)
+		}
+		if filter.Limit > 0 {
+			query = query.Limit(filter.Limit)
+		}
+		return query.Find(ctx)
+	})
+}
+
+func (gs *GormStore) Transaction(ctx context.Context, placement Placement, fn func(AdSpotStore) error) error {
+	return gs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(lockPlacement, placement).Error; err != nil {
+			return err
+		}
+		return fn(&GormStore{db: tx})
+	})
+}
+
+func (gs *GormStore) DeactivateExpired(ctx context.Context, now time.Time) (int, error) {
+	return gorm.G[AdSpot](gs.db).
+		Where("status IN ? AND expires_at < ?", []Status{StatusActive, StatusPaused}, ISO8601(now)).
+		Set(
+			clause.Assignment{Column: clause.Column{Name: "status"}, Value: StatusDeactivated},
+			clause.Assignment{Column: clause.Column{Name: "deactivated_at"}, Value: clause.Expr{SQL: "expires_at"}},
+			clause.Assignment{Column: clause.Column{Name: "deactivation_reason"}, Value: DeactivationTTLExpired},
+			clause.Assignment{Column: clause.Column{Name: "version"}, Value: clause.Expr{SQL: "version + 1"}},
+		).
+		Update(ctx)
+}
@@ -0,0 +1,49 @@
+package adspots
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Sweeper periodically deactivates ad spots whose TTL has run out, so that
+// their stored status matches what the list endpoint reports.
+type Sweeper struct {
+	store    AdSpotStore
+	interval time.Duration
+}
+
+func NewSweeper(store AdSpotStore, interval time.Duration) *Sweeper {
+	if interval <= 0 {
+		interval = time.Minute // Default: sweep every minute
+	}
+
+	return &Sweeper{
+		store:    store,
+		interval: interval,
+	}
+}
+
+// Run sweeps once per interval until the context is cancelled.
+func (sw *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(sw.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := sw.Sweep(ctx); err != nil && ctx.Err() == nil {
+				log.Print("error while sweeping expired ad spots: ", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sweep deactivates every active or paused ad spot that has expired,
+// back-dating DeactivatedAt to the moment it expired. It returns the number of
+// ad spots deactivated.
+func (sw *Sweeper) Sweep(ctx context.Context) (int, error) {
+	return sw.store.DeactivateExpired(ctx, time.Now())
+}
@@ -0,0 +1,89 @@
+package t
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestThompsonSelector(t *testing.T) {
+	candidates := []adspots.AdSpot{{ID: "good"}, {ID: "bad"}, {ID: "new"}}
+	stats := map[string]adspots.Counts{
+		"good": {Impressions: 1000, Clicks: 100},
+		"bad":  {Impressions: 1000, Clicks: 10},
+	}
+
+	// The same seed always yields the same picks
+	first, second := adspots.NewThompsonSelector(42), adspots.NewThompsonSelector(42)
+	picked := map[string]int{}
+	for range 500 {
+		a := first.SelectWithStats(adspots.PlacementHomeScreen, candidates, stats)
+		b := second.SelectWithStats(adspots.PlacementHomeScreen, candidates, stats)
+		if a.ID != b.ID {
+			t.Fatalf("Expected seeded selectors to agree, got %s and %s", a.ID, b.ID)
+		}
+		picked[a.ID]++
+	}
+
+	// Unproven ad spots are explored, since they could be the best
+	if picked["new"] == 0 {
+		t.Errorf("Expected the new ad spot to be explored, got %v", picked)
+	}
+
+	// Among proven ad spots, the best one wins
+	picked = map[string]int{}
+	for range 500 {
+		picked[first.SelectWithStats(adspots.PlacementHomeScreen, candidates[:2], stats).ID]++
+	}
+	if picked["good"] < 490 {
+		t.Errorf("Expected the ad spot with the best CTR to win, got %v", picked)
+	}
+}
+
+func TestThompsonServing(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+	server.SetSelector(adspots.NewThompsonSelector(7))
+
+	better := createAdSpot(t, server, `{"title":"Better","imageUrl":"https://example.com/a.png","placement":"ride_summary"}`)
+	worse := createAdSpot(t, server, `{"title":"Worse","imageUrl":"https://example.com/a.png","placement":"ride_summary"}`)
+
+	var events []map[string]any
+	for i := range 200 {
+		for _, spot := range []adspots.AdSpot{better, worse} {
+			events = append(events, map[string]any{"eventId": fmt.Sprint(spot.ID, "-i", i), "adSpotId": spot.ID, "type": "impression", "clientId": "rider"})
+		}
+		if i%5 == 0 {
+			events = append(events, map[string]any{"eventId": fmt.Sprint(better.ID, "-c", i), "adSpotId": better.ID, "type": "click", "clientId": "rider"})
+		}
+		if i%50 == 0 {
+			events = append(events, map[string]any{"eventId": fmt.Sprint(worse.ID, "-c", i), "adSpotId": worse.ID, "type": "click", "clientId": "rider"})
+		}
+	}
+	req := httptest.NewRequest("POST", "/events", jsonBody(map[string]any{"events": events}))
+	w := httptest.NewRecorder()
+	server.RecordEvents(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	served := map[string]int{}
+	for range 100 {
+		spot, code := serveAdSpot(t, server, "placement=ride_summary")
+		if code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		served[spot.ID]++
+	}
+	if served[better.ID] < 90 {
+		t.Errorf("Expected traffic to shift towards the better ad spot, got %d of 100", served[better.ID])
+	}
+
+	if _, err := adspots.ParseSelector("thompson", 7); err != nil {
+		t.Errorf("Expected the thompson strategy to be known, got %v", err)
+	}
+}
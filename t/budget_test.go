@@ -0,0 +1,188 @@
+package t
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func getCampaign(t *testing.T, server *adspots.Server, id string) adspots.Campaign {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/campaigns/"+id, nil)
+	req.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	server.GetCampaign(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var campaign adspots.Campaign
+	if err := json.Unmarshal(w.Body.Bytes(), &campaign); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return campaign
+}
+
+func TestBudgetPacing(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
+
+		acme := createResource[adspots.Advertiser](t, server.CreateAdvertiser, "/advertisers", map[string]any{"name": "Acme"})
+		// Impressions cost 1000 micros, so an hour of the daily budget buys 10
+		campaign := createResource[adspots.Campaign](t, server.CreateCampaign, "/campaigns", map[string]any{
+			"advertiserId":      acme.ID,
+			"name":              "Evenly paced",
+			"dailyBudgetMicros": 240000,
+			"pricing":           "cpm",
+			"rateMicros":        1000000,
+		})
+		if campaign.Pacing != adspots.PacingEven {
+			t.Errorf("Expected campaigns to be evenly paced by default, got %v", campaign.Pacing)
+		}
+		spot := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+			"title":      "Acme",
+			"imageUrl":   "https://example.com/a.png",
+			"placement":  "home_screen",
+			"campaignId": campaign.ID,
+		})))
+
+		// The bubble's clock starts at midnight UTC
+		for i := range 10 {
+			if _, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusOK {
+				t.Fatalf("Expected the ad spot to be served within its pacing, got %d", code)
+			}
+			recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": fmt.Sprint("e", i), "clientId": "rider-1"})
+		}
+
+		if _, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusNoContent {
+			t.Errorf("Expected 204 once the campaign is ahead of its pacing, got %d", code)
+		}
+		got := getCampaign(t, server, campaign.ID)
+		if got.Budget == nil || got.Budget.TodayMicros != 10000 || !got.Budget.Throttled || got.Budget.Exhausted {
+			t.Errorf("Expected a throttled budget state, got %+v", got.Budget)
+		}
+
+		time.Sleep(time.Hour)
+		if _, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusOK {
+			t.Errorf("Expected the ad spot to be served again an hour later, got %d", code)
+		}
+	})
+}
+
+func TestBudgetExhaustion(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	acme := createResource[adspots.Advertiser](t, server.CreateAdvertiser, "/advertisers", map[string]any{"name": "Acme"})
+	campaign := createResource[adspots.Campaign](t, server.CreateCampaign, "/campaigns", map[string]any{
+		"advertiserId":         acme.ID,
+		"name":                 "Pay per click",
+		"lifetimeBudgetMicros": 1000000,
+		"pricing":              "cpc",
+		"rateMicros":           500000,
+		"pacing":               "asap",
+	})
+	spot := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+		"title":      "Acme",
+		"imageUrl":   "https://example.com/a.png",
+		"placement":  "home_screen",
+		"campaignId": campaign.ID,
+	})))
+
+	// Impressions are free under CPC pricing
+	for i := range 5 {
+		recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": fmt.Sprint("i", i), "clientId": "rider-1"})
+	}
+	for i := range 2 {
+		if _, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusOK {
+			t.Fatalf("Expected the ad spot to be served before exhausting its budget, got %d", code)
+		}
+		recordEvent(t, server, spot.ID, adspots.EventClick, map[string]any{"eventId": fmt.Sprint("c", i), "clientId": "rider-1"})
+	}
+	// Retried events aren't charged twice
+	recordEvent(t, server, spot.ID, adspots.EventClick, map[string]any{"eventId": "c1", "clientId": "rider-1"})
+
+	if _, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusNoContent {
+		t.Errorf("Expected 204 once the budget is exhausted, got %d", code)
+	}
+	got := getCampaign(t, server, campaign.ID)
+	if got.Budget == nil || got.Budget.LifetimeMicros != 1000000 || !got.Budget.Exhausted {
+		t.Errorf("Expected an exhausted budget state, got %+v", got.Budget)
+	}
+
+	for _, body := range []map[string]any{
+		{"advertiserId": acme.ID, "name": "No pricing", "dailyBudgetMicros": 1000},
+		{"advertiserId": acme.ID, "name": "No rate", "pricing": "cpm"},
+		{"advertiserId": acme.ID, "name": "Negative", "dailyBudgetMicros": -1, "pricing": "cpm", "rateMicros": 1},
+	} {
+		req := httptest.NewRequest("POST", "/campaigns", jsonBody(body))
+		w := httptest.NewRecorder()
+		server.CreateCampaign(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %v, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestBudgetSpendPrecision(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
+
+		acme := createResource[adspots.Advertiser](t, server.CreateAdvertiser, "/advertisers", map[string]any{"name": "Acme"})
+		// Impressions cost 1.5 micros each
+		campaign := createResource[adspots.Campaign](t, server.CreateCampaign, "/campaigns", map[string]any{
+			"advertiserId":      acme.ID,
+			"name":              "Cheap",
+			"dailyBudgetMicros": 1000000,
+			"pricing":           "cpm",
+			"rateMicros":        1500,
+		})
+		spot := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+			"title":      "Acme",
+			"imageUrl":   "https://example.com/a.png",
+			"placement":  "home_screen",
+			"campaignId": campaign.ID,
+		})))
+
+		// The bubble's clock starts at midnight UTC, so the last impression
+		// claims to be from yesterday, but is received today
+		for i := range 2 {
+			recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": fmt.Sprint("e", i), "clientId": "rider-1"})
+		}
+		recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{
+			"eventId":   "late",
+			"clientId":  "rider-1",
+			"timestamp": adspots.ISO8601(time.Now().Add(-time.Minute)),
+		})
+
+		got := getCampaign(t, server, campaign.ID)
+		if got.Budget == nil || got.Budget.TodayMicros != 4 || got.Budget.LifetimeMicros != 4 {
+			t.Errorf("Expected 4.5 micros to be charged today, got %+v", got.Budget)
+		}
+	})
+}
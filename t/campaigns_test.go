@@ -0,0 +1,195 @@
+package t
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func createResource[T any](t *testing.T, handler http.HandlerFunc, path string, body any) T {
+	req := httptest.NewRequest("POST", path, jsonBody(body))
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resource T
+	if err := json.Unmarshal(w.Body.Bytes(), &resource); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return resource
+}
+
+func TestCampaigns(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	acme := createResource[adspots.Advertiser](t, server.CreateAdvertiser, "/advertisers", map[string]any{"name": "Acme"})
+	campaign := createResource[adspots.Campaign](t, server.CreateCampaign, "/campaigns", map[string]any{
+		"advertiserId": acme.ID,
+		"name":         "Spring sale",
+	})
+	if campaign.Status != adspots.StatusActive {
+		t.Errorf("Expected new campaigns to be active, got %v", campaign.Status)
+	}
+
+	grouped := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+		"title":      "Acme",
+		"imageUrl":   "https://example.com/a.png",
+		"placement":  "home_screen",
+		"campaignId": campaign.ID,
+	})))
+	standalone := createAdSpot(t, server, `{"title":"Standalone","imageUrl":"https://example.com/a.png","placement":"home_screen"}`)
+
+	response := listAdSpots(t, server, url.Values{"campaignId": {campaign.ID}})
+	if len(response.Data) != 1 || response.Data[0].ID != grouped.ID {
+		t.Errorf("Expected only the campaign's ad spot to be listed, got %d ad spots", len(response.Data))
+	}
+
+	// Pausing the campaign hides its ad spots, without touching their status
+	req := httptest.NewRequest("PATCH", "/campaigns/"+campaign.ID, jsonBody(map[string]any{"status": "paused"}))
+	req.SetPathValue("id", campaign.ID)
+	w := httptest.NewRecorder()
+	server.PatchCampaign(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	response = listAdSpots(t, server, url.Values{"status": {"active"}})
+	if len(response.Data) != 1 || response.Data[0].ID != standalone.ID {
+		t.Errorf("Expected only the standalone ad spot to be active, got %d ad spots", len(response.Data))
+	}
+	for range 10 {
+		if spot, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusOK || spot.ID != standalone.ID {
+			t.Errorf("Expected only the standalone ad spot to be served, got %s with %d", spot.ID, code)
+		}
+	}
+	if spot := getAdSpot(t, server, grouped.ID, ""); spot.Status != adspots.StatusActive {
+		t.Errorf("Expected the ad spot to keep its own status, got %v", spot.Status)
+	}
+
+	// It reports itself as inactive all the same
+	req = httptest.NewRequest("GET", "/adspots/"+grouped.ID, nil)
+	req.SetPathValue("id", grouped.ID)
+	w = httptest.NewRecorder()
+	server.GetAdSpot(w, req)
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if body["effectiveStatus"] != string(adspots.EffectiveInactive) {
+		t.Errorf("Expected the ad spot of a paused campaign to be inactive, got %v", body["effectiveStatus"])
+	}
+
+	req = httptest.NewRequest("GET", "/adspots?campaignId="+campaign.ID, nil)
+	w = httptest.NewRecorder()
+	server.ListAdSpots(w, req)
+	var list struct {
+		Data []map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(list.Data) != 1 || list.Data[0]["effectiveStatus"] != string(adspots.EffectiveInactive) {
+		t.Errorf("Expected the listed ad spot to be inactive, got %v", list.Data)
+	}
+
+	// Resources in use cannot be deleted
+	for _, tc := range []struct {
+		handler http.HandlerFunc
+		id      string
+	}{
+		{server.DeleteAdvertiser, acme.ID},
+		{server.DeleteCampaign, campaign.ID},
+	} {
+		req := httptest.NewRequest("DELETE", "/", nil)
+		req.SetPathValue("id", tc.id)
+		w := httptest.NewRecorder()
+		tc.handler(w, req)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected 409 when deleting %s, got %d", tc.id, w.Code)
+		}
+	}
+}
+
+func TestCampaignValidation(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	acme := createResource[adspots.Advertiser](t, server.CreateAdvertiser, "/advertisers", map[string]any{"name": "Acme"})
+
+	for _, tc := range []struct {
+		handler http.HandlerFunc
+		body    map[string]any
+	}{
+		{server.CreateAdvertiser, map[string]any{"name": ""}},
+		{server.CreateCampaign, map[string]any{"name": "Orphan", "advertiserId": "missing"}},
+		{server.CreateCampaign, map[string]any{"name": "Draft", "advertiserId": acme.ID, "status": "draft"}},
+		{server.CreateAdSpot, map[string]any{"title": "Lost", "imageUrl": "https://example.com/a.png", "placement": "home_screen", "campaignId": "missing"}},
+	} {
+		req := httptest.NewRequest("POST", "/", jsonBody(tc.body))
+		w := httptest.NewRecorder()
+		tc.handler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %v, got %d", tc.body, w.Code)
+		}
+	}
+}
+
+func TestCampaignStatus(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	acme := createResource[adspots.Advertiser](t, server.CreateAdvertiser, "/advertisers", map[string]any{"name": "Acme"})
+	campaign := createResource[adspots.Campaign](t, server.CreateCampaign, "/campaigns", map[string]any{
+		"advertiserId": acme.ID,
+		"name":         "Spring sale",
+	})
+
+	steps := []struct {
+		patch       string
+		code        int
+		status      adspots.Status
+		description string
+	}{
+		{`{"status":null}`, http.StatusBadRequest, adspots.StatusActive, "Status cannot be removed"},
+		{`{"status":"draft"}`, http.StatusBadRequest, adspots.StatusActive, "Campaigns have no draft status"},
+		{`{"status":"paused"}`, http.StatusOK, adspots.StatusPaused, "Active campaigns can be paused"},
+		{`{"status":"deactivated"}`, http.StatusOK, adspots.StatusDeactivated, "Paused campaigns can be deactivated"},
+		{`{"status":"paused"}`, http.StatusConflict, adspots.StatusDeactivated, "Deactivated campaigns cannot be paused"},
+		{`{"name":"Renamed"}`, http.StatusOK, adspots.StatusDeactivated, "Other fields can change without a transition"},
+		{`{"status":"active"}`, http.StatusOK, adspots.StatusActive, "Deactivated campaigns can be reactivated"},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest("PATCH", "/campaigns/"+campaign.ID, strings.NewReader(step.patch))
+		req.SetPathValue("id", campaign.ID)
+		w := httptest.NewRecorder()
+		server.PatchCampaign(w, req)
+		if w.Code != step.code {
+			t.Errorf("[%s] Expected %d, got %d: %s", step.description, step.code, w.Code, w.Body.String())
+		}
+
+		req = httptest.NewRequest("GET", "/campaigns/"+campaign.ID, nil)
+		req.SetPathValue("id", campaign.ID)
+		w = httptest.NewRecorder()
+		server.GetCampaign(w, req)
+		var stored adspots.Campaign
+		if err := json.Unmarshal(w.Body.Bytes(), &stored); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if stored.Status != step.status {
+			t.Errorf("[%s] Expected status %v, got %v", step.description, step.status, stored.Status)
+		}
+	}
+}
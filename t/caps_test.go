@@ -0,0 +1,97 @@
+package t
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func getAdSpot(t *testing.T, server *adspots.Server, id, query string) adspots.AdSpot {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/adspots/"+id+"?"+query, nil)
+	req.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	server.GetAdSpot(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var spot adspots.AdSpot
+	if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return spot
+}
+
+func TestImpressionCaps(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, `{"title":"Capped","imageUrl":"https://example.com/a.png","placement":"home_screen","maxImpressions":2}`)
+
+	for i := range 2 {
+		if served, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusOK || served.ID != spot.ID {
+			t.Fatalf("Expected the ad spot to be served before reaching its cap, got %d", code)
+		}
+		recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": fmt.Sprint("e", i), "clientId": fmt.Sprint("rider-", i)})
+	}
+
+	if _, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusNoContent {
+		t.Errorf("Expected 204 once the ad spot reached its cap, got %d", code)
+	}
+
+	got := getAdSpot(t, server, spot.ID, "")
+	if got.CapState == nil || got.CapState.Impressions != 2 || got.CapState.Remaining == nil || *got.CapState.Remaining != 0 || !got.CapState.Exhausted {
+		t.Errorf("Expected an exhausted cap state, got %+v", got.CapState)
+	}
+}
+
+func TestFrequencyCaps(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, `{"title":"Capped","imageUrl":"https://example.com/a.png","placement":"ride_summary","frequencyCap":{"count":1,"windowMinutes":60}}`)
+
+	// The cap can't be checked without a client, even before any impression
+	if _, code := serveAdSpot(t, server, "placement=ride_summary"); code != http.StatusNoContent {
+		t.Errorf("Expected 204 without a client ID, got %d", code)
+	}
+	if _, code := serveAdSpot(t, server, "placement=ride_summary&clientId=rider-1"); code != http.StatusOK {
+		t.Fatalf("Expected 200 before the first impression, got %d", code)
+	}
+	recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider-1"})
+
+	if _, code := serveAdSpot(t, server, "placement=ride_summary&clientId=rider-1"); code != http.StatusNoContent {
+		t.Errorf("Expected 204 for a client that reached the frequency cap, got %d", code)
+	}
+	if _, code := serveAdSpot(t, server, "placement=ride_summary&clientId=rider-2"); code != http.StatusOK {
+		t.Errorf("Expected 200 for another client, got %d", code)
+	}
+
+	got := getAdSpot(t, server, spot.ID, "clientId=rider-1")
+	if got.CapState == nil || !got.CapState.FrequencyCapped || got.CapState.ClientImpressions == nil || *got.CapState.ClientImpressions != 1 {
+		t.Errorf("Expected a frequency capped state, got %+v", got.CapState)
+	}
+
+	for _, body := range []string{
+		`{"title":"Capped","imageUrl":"https://example.com/a.png","placement":"ride_summary","frequencyCap":{"count":0,"windowMinutes":60}}`,
+		`{"title":"Capped","imageUrl":"https://example.com/a.png","placement":"ride_summary","frequencyCap":{"count":1}}`,
+		`{"title":"Capped","imageUrl":"https://example.com/a.png","placement":"ride_summary","maxImpressions":0}`,
+	} {
+		req := httptest.NewRequest("POST", "/adspots", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package t
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestCreatives(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+		"title":     "Spring sale",
+		"imageUrl":  "https://example.com/a.png",
+		"placement": "home_screen",
+		"creatives": []map[string]any{
+			{"id": "blue", "title": "Spring sale", "imageUrl": "https://example.com/blue.png"},
+			{"id": "green", "title": "Spring sale!", "imageUrl": "https://example.com/green.png"},
+		},
+	})))
+	if spot.Creatives[0].Weight != 1 {
+		t.Errorf("Expected creatives to default to a weight of 1, got %d", spot.Creatives[0].Weight)
+	}
+
+	// Each rider keeps seeing the same creative, and both get served
+	assigned := map[string]string{}
+	for i := range 20 {
+		client := fmt.Sprint("rider-", i)
+		for range 3 {
+			served, code := serveAdSpot(t, server, "placement=home_screen&clientId="+client)
+			if code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", code)
+			}
+			if previous, ok := assigned[client]; ok && previous != served.CreativeID {
+				t.Errorf("Expected %s to stick to creative %s, got %s", client, previous, served.CreativeID)
+			}
+			assigned[client] = served.CreativeID
+			if creative := map[string]string{"blue": "https://example.com/blue.png", "green": "https://example.com/green.png"}[served.CreativeID]; served.ImageURL != creative {
+				t.Errorf("Expected the image of creative %q, got %s", served.CreativeID, served.ImageURL)
+			}
+		}
+	}
+	counts := map[string]int{}
+	for _, creative := range assigned {
+		counts[creative]++
+	}
+	if counts["blue"] == 0 || counts["green"] == 0 {
+		t.Errorf("Expected both creatives to be assigned, got %v", counts)
+	}
+
+	// Events are attributed to the creative assigned to the rider, unless the
+	// client names it
+	for i := range 20 {
+		client := fmt.Sprint("rider-", i)
+		recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": fmt.Sprint("i", i), "clientId": client})
+	}
+	recordEvent(t, server, spot.ID, adspots.EventClick, map[string]any{"eventId": "c0", "clientId": "rider-0", "creativeId": "green"})
+	if code := recordEvent(t, server, spot.ID, adspots.EventClick, map[string]any{"eventId": "c1", "clientId": "rider-0", "creativeId": "red"}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown creative, got %d", code)
+	}
+
+	req := httptest.NewRequest("GET", "/adspots/"+spot.ID+"/stats?granularity=day", nil)
+	req.SetPathValue("id", spot.ID)
+	w := httptest.NewRecorder()
+	server.AdSpotStats(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var stats adspots.AdSpotStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(stats.Creatives) != 2 {
+		t.Fatalf("Expected stats for 2 creatives, got %+v", stats.Creatives)
+	}
+	for _, creative := range stats.Creatives {
+		expectedClicks := map[string]int64{"green": 1}[creative.CreativeID]
+		if creative.Impressions != int64(counts[creative.CreativeID]) || creative.Clicks != expectedClicks {
+			t.Errorf("Unexpected stats for creative %s: %+v", creative.CreativeID, creative.Counts)
+		}
+	}
+}
+
+func TestCreativeValidation(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	for _, creatives := range [][]map[string]any{
+		{{"title": "No ID", "imageUrl": "https://example.com/a.png"}},
+		{{"id": "a", "title": "A", "imageUrl": "https://example.com/a.png"}, {"id": "a", "title": "B", "imageUrl": "https://example.com/b.png"}},
+		{{"id": "a", "imageUrl": "https://example.com/a.png"}},
+		{{"id": "a", "title": "A", "imageUrl": "https://example.com/a.png", "weight": -1}},
+		// Like ad spot weights, creative weights start at 1
+		{{"id": "a", "title": "A", "imageUrl": "https://example.com/a.png", "weight": 0}},
+	} {
+		req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{
+			"title":     "Invalid",
+			"imageUrl":  "https://example.com/a.png",
+			"placement": "home_screen",
+			"creatives": creatives,
+		}))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for creatives %v, got %d", creatives, w.Code)
+		}
+	}
+}
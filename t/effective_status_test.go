@@ -0,0 +1,158 @@
+package t
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+func TestEffectiveStatus(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
+
+		testCases := []struct {
+			name        string
+			ttl         *int
+			status      adspots.Status
+			reason      adspots.DeactivationReason
+			expected    adspots.EffectiveStatus
+			description string
+		}{
+			{
+				name:        "active_no_ttl",
+				status:      adspots.StatusActive,
+				expected:    adspots.EffectiveActive,
+				description: "Active ad spots without TTL are active",
+			},
+			{
+				name:        "active_within_ttl",
+				ttl:         intPtr(120),
+				status:      adspots.StatusActive,
+				expected:    adspots.EffectiveActive,
+				description: "Active ad spots within TTL are active",
+			},
+			{
+				name:        "active_expired",
+				ttl:         intPtr(30),
+				status:      adspots.StatusActive,
+				expected:    adspots.EffectiveExpired,
+				description: "Active ad spots past TTL are expired",
+			},
+			{
+				name:        "swept_expired",
+				ttl:         intPtr(30),
+				status:      adspots.StatusDeactivated,
+				reason:      adspots.DeactivationTTLExpired,
+				expected:    adspots.EffectiveExpired,
+				description: "Ad spots deactivated by the sweeper are expired",
+			},
+			{
+				name:        "manually_deactivated",
+				ttl:         intPtr(30),
+				status:      adspots.StatusDeactivated,
+				reason:      adspots.DeactivationManual,
+				expected:    adspots.EffectiveInactive,
+				description: "Ad spots deactivated by hand are inactive",
+			},
+			{
+				name:        "paused",
+				status:      adspots.StatusPaused,
+				expected:    adspots.EffectiveInactive,
+				description: "Paused ad spots are inactive",
+			},
+		}
+
+		for _, tc := range testCases {
+			ad := adspots.AdSpot{
+				ID:                 tc.name,
+				Title:              "Test ad: " + tc.name,
+				ImageURL:           "https://example.com/image.png",
+				TTLMinutes:         tc.ttl,
+				Placement:          adspots.PlacementHomeScreen,
+				CreatedAt:          adspots.ISO8601(time.Now()),
+				Status:             tc.status,
+				DeactivationReason: tc.reason,
+			}
+			if err := gorm.G[adspots.AdSpot](db).Create(t.Context(), &ad); err != nil {
+				t.Fatalf("Failed to insert test case %s: %v", tc.name, err)
+			}
+		}
+
+		time.Sleep(1 * time.Hour)
+
+		var expired []string
+		for _, tc := range testCases {
+			req := httptest.NewRequest("GET", "/adspots/"+tc.name, nil)
+			req.SetPathValue("id", tc.name)
+			w := httptest.NewRecorder()
+			server.GetAdSpot(w, req)
+
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if body["effectiveStatus"] != string(tc.expected) {
+				t.Errorf("[%s] Expected effective status %q, got %v", tc.description, tc.expected, body["effectiveStatus"])
+			}
+			if _, ok := body["expiresAt"]; ok != (tc.ttl != nil) {
+				t.Errorf("[%s] Expected expiresAt to be present only with a TTL, got %v", tc.description, body["expiresAt"])
+			}
+
+			if tc.expected == adspots.EffectiveExpired {
+				expired = append(expired, tc.name)
+			}
+		}
+
+		response := listAdSpots(t, server, url.Values{"status": {"expired"}})
+		var got []string
+		for _, ad := range response.Data {
+			got = append(got, ad.ID)
+		}
+		slices.Sort(got)
+		slices.Sort(expired)
+		if !slices.Equal(got, expired) {
+			t.Errorf("Expected status=expired to return %v, got %v", expired, got)
+		}
+	})
+}
+
+// Ad spots deactivated before reasons were stored have none, and are inactive.
+func TestEffectiveStatusWithoutReason(t *testing.T) {
+	db := setupDatabase(t)
+	past := adspots.ISO8601(time.Now().Add(-time.Hour))
+	err := db.Exec("INSERT INTO ad_spots (id, title, image_url, placement, priority, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		"legacy", "Legacy", "https://example.com/a.png", adspots.PlacementHomeScreen, 0, adspots.StatusDeactivated, past, past).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := adspots.AdSpotFilter{Effective: []adspots.EffectiveStatus{adspots.EffectiveInactive}}
+	for name, store := range map[string]adspots.AdSpotStore{"gorm": adspots.NewGormStore(db), "sql": adspots.NewSQLStore(sqlDB, adspots.DriverSQLite)} {
+		spots, err := store.List(t.Context(), filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(spots) != 1 || spots[0].ID != "legacy" {
+			t.Errorf("[%s] Expected the ad spot to be inactive, got %+v", name, spots)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package t
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestETags(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, `{"title":"Versioned","imageUrl":"https://example.com/a.png","placement":"home_screen"}`)
+
+	// send calls the handler for the ad spot with the given conditional
+	// request header, returning the response
+	send := func(handler http.HandlerFunc, method, body, header, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/adspots/"+spot.ID, strings.NewReader(body))
+		req.SetPathValue("id", spot.ID)
+		if header != "" {
+			req.Header.Set(header, etag)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := send(server.GetAdSpot, "GET", "", "", "")
+	first := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || first == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d %q", w.Code, first)
+	}
+
+	steps := []struct {
+		handler     http.HandlerFunc
+		method      string
+		body        string
+		header      string
+		etag        string
+		code        int
+		description string
+	}{
+		{server.GetAdSpot, "GET", "", "If-None-Match", first, http.StatusNotModified, "Unchanged ad spots are not sent again"},
+		{server.GetAdSpot, "GET", "", "If-None-Match", "W/" + first, http.StatusNotModified, "If-None-Match compares weakly"},
+		{server.GetAdSpot, "GET", "", "If-None-Match", `"other"`, http.StatusOK, "Other ETags get the ad spot"},
+		{server.PatchAdSpot, "PATCH", `{"title":"Renamed"}`, "If-Match", first, http.StatusOK, "Patches of the current version apply"},
+		{server.PatchAdSpot, "PATCH", `{"title":"Lost"}`, "If-Match", first, http.StatusPreconditionFailed, "Patches of an old version fail"},
+		{server.ReplaceAdSpot, "PUT", `{"title":"Lost","imageUrl":"https://example.com/a.png","placement":"home_screen"}`, "If-Match", first, http.StatusPreconditionFailed, "Replacements of an old version fail"},
+		{server.DeactivateAdSpot, "POST", "", "If-Match", first, http.StatusPreconditionFailed, "Transitions of an old version fail"},
+		{server.GetAdSpot, "GET", "", "If-None-Match", first, http.StatusOK, "Changed ad spots are sent again"},
+		{server.DeactivateAdSpot, "POST", "", "If-Match", "*", http.StatusOK, "If-Match accepts any version of an existing ad spot"},
+		{server.ActivateAdSpot, "POST", "", "", "", http.StatusOK, "Requests without If-Match are unconditional"},
+	}
+	for _, step := range steps {
+		w := send(step.handler, step.method, step.body, step.header, step.etag)
+		if w.Code != step.code {
+			t.Errorf("[%s] Expected %d, got %d: %s", step.description, step.code, w.Code, w.Body.String())
+		}
+	}
+
+	// Mutations answer with the ETag of the version they wrote
+	w = send(server.PauseAdSpot, "POST", "", "", "")
+	etag := w.Header().Get("ETag")
+	if etag == "" || etag == first {
+		t.Fatalf("Expected a new ETag after pausing, got %q", etag)
+	}
+	if w := send(server.GetAdSpot, "GET", "", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected the ETag of the pause to be current, got %d", w.Code)
+	}
+	if w := send(server.PatchAdSpot, "PATCH", `{"priority":2}`, "If-Match", `"stale", `+etag); w.Code != http.StatusOK {
+		t.Errorf("Expected If-Match to accept a list of ETags, got %d: %s", w.Code, w.Body.String())
+	}
+
+	stored, err := adspots.NewGormStore(db).Get(t.Context(), spot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "Renamed" || stored.Status != adspots.StatusPaused || stored.Priority != 2 {
+		t.Errorf("Expected only the matching requests to apply, got %+v", stored)
+	}
+}
+
+func TestETagsCapState(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, `{"title":"Capped","imageUrl":"https://example.com/a.png","placement":"home_screen","maxImpressions":10}`)
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/adspots/"+spot.ID, nil)
+		req.SetPathValue("id", spot.ID)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		server.GetAdSpot(w, req)
+		return w
+	}
+
+	etag := get("").Header().Get("ETag")
+	if w := get(etag); w.Code != http.StatusNotModified {
+		t.Fatalf("Expected 304 before any impression, got %d", w.Code)
+	}
+
+	// Impressions change the cap state without changing the version
+	if code := recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider-1"}); code != http.StatusCreated {
+		t.Fatalf("Failed to record an impression: %d", code)
+	}
+	w := get(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the ad spot to be sent again after an impression, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"remaining":9`) {
+		t.Errorf("Expected the new cap state, got %s", w.Body.String())
+	}
+}
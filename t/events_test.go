@@ -0,0 +1,102 @@
+package t
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+func recordEvent(t *testing.T, server *adspots.Server, id string, kind adspots.EventType, body any) int {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/adspots/"+id+"/"+string(kind)+"s", jsonBody(body))
+	req.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	if kind == adspots.EventClick {
+		server.RecordClick(w, req)
+	} else {
+		server.RecordImpression(w, req)
+	}
+	return w.Code
+}
+
+func TestEvents(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, `{"title":"Tracked","imageUrl":"https://example.com/a.png","placement":"home_screen"}`)
+
+	steps := []struct {
+		kind        adspots.EventType
+		body        map[string]any
+		code        int
+		description string
+	}{
+		{adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider-1"}, http.StatusCreated, "New impressions are recorded"},
+		{adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider-1"}, http.StatusOK, "Retried impressions are deduplicated"},
+		{adspots.EventClick, map[string]any{"eventId": "e2", "clientId": "rider-1", "placement": "home_screen"}, http.StatusCreated, "New clicks are recorded"},
+		{adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider-2"}, http.StatusCreated, "Event IDs are only unique per client"},
+		{adspots.EventClick, map[string]any{"clientId": "rider-1"}, http.StatusBadRequest, "Event IDs are required"},
+		{adspots.EventClick, map[string]any{"eventId": "e3"}, http.StatusBadRequest, "Client IDs are required"},
+		{adspots.EventClick, map[string]any{"eventId": "e3", "clientId": "rider-1", "placement": "nowhere"}, http.StatusBadRequest, "Placements are validated"},
+		{adspots.EventClick, map[string]any{"eventId": "e3", "clientId": "rider-1", "placement": "map_view"}, http.StatusBadRequest, "Placements must be the ad spot's"},
+		{adspots.EventClick, map[string]any{"eventId": "e3", "clientId": "rider-1", "timestamp": adspots.ISO8601(time.Now().Add(-time.Hour))}, http.StatusBadRequest, "Events can't be backdated"},
+		{adspots.EventClick, map[string]any{"eventId": "e3", "clientId": "rider-1", "timestamp": adspots.ISO8601(time.Now().Add(time.Hour))}, http.StatusBadRequest, "Events can't be postdated"},
+		{adspots.EventClick, map[string]any{"eventId": "e3", "clientId": "rider-1", "timestamp": adspots.ISO8601(time.Now().Add(-time.Minute))}, http.StatusCreated, "Events may be reported late"},
+	}
+	for _, step := range steps {
+		if code := recordEvent(t, server, spot.ID, step.kind, step.body); code != step.code {
+			t.Errorf("[%s] Expected %d, got %d", step.description, step.code, code)
+		}
+	}
+
+	if code := recordEvent(t, server, "missing", adspots.EventImpression, map[string]any{"eventId": "e4", "clientId": "rider-1"}); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing ad spot, got %d", code)
+	}
+
+	batch := func(events ...map[string]any) (int, map[string]int) {
+		req := httptest.NewRequest("POST", "/events", jsonBody(map[string]any{"events": events}))
+		w := httptest.NewRecorder()
+		server.RecordEvents(w, req)
+
+		var counts map[string]int
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &counts); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+		}
+		return w.Code, counts
+	}
+
+	code, counts := batch(
+		map[string]any{"adSpotId": spot.ID, "type": "impression", "eventId": "e1", "clientId": "rider-1"},
+		map[string]any{"adSpotId": spot.ID, "type": "impression", "eventId": "e5", "clientId": "rider-2"},
+		map[string]any{"adSpotId": spot.ID, "type": "click", "eventId": "e6", "clientId": "rider-2"},
+		map[string]any{"adSpotId": spot.ID, "type": "click", "eventId": "e6", "clientId": "rider-2"},
+	)
+	if code != http.StatusOK || counts["accepted"] != 2 || counts["duplicates"] != 2 {
+		t.Errorf("Expected 2 accepted and 2 duplicate events, got %d: %v", code, counts)
+	}
+
+	code, _ = batch(
+		map[string]any{"adSpotId": spot.ID, "type": "impression", "eventId": "e7", "clientId": "rider-3"},
+		map[string]any{"adSpotId": "missing", "type": "impression", "eventId": "e8", "clientId": "rider-3"},
+	)
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a batch referencing a missing ad spot, got %d", code)
+	}
+
+	count, err := gorm.G[adspots.Event](db).Count(t.Context(), "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 6 {
+		t.Errorf("Expected 6 events to be stored, got %d", count)
+	}
+}
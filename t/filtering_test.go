@@ -13,12 +13,36 @@ import (
 	"gorm.io/gorm"
 )
 
-func setupDatabase(t *testing.T) *gorm.DB {
+// models lists every table the server uses.
+var models = []any{&adspots.AdSpot{}, &adspots.Event{}, &adspots.EventRollup{}, &adspots.Advertiser{}, &adspots.Campaign{}, &adspots.CampaignSpend{}, &adspots.CreativeRollup{}, &adspots.PlacementConfig{}}
+
+// openDatabase returns an empty in-memory database, without any schema.
+func openDatabase(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	db.AutoMigrate(&adspots.AdSpot{})
+	// Every connection to :memory: opens a separate, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+func setupDatabase(t *testing.T) *gorm.DB {
+	db := openDatabase(t)
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := adspots.LoadPlacements(t.Context(), db); err != nil {
+		t.Fatal(err)
+	}
 	return db.Debug()
 }
 
@@ -31,47 +55,47 @@ func TestFiltering(t *testing.T) {
 		}
 		defer sqlDB.Close()
 
-		server := adspots.NewServer(db)
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
 
 		testCases := []struct {
 			name        string
 			ttl         *int
-			status      bool
+			status      adspots.Status
 			shouldShow  bool
 			description string
 		}{
 			{
 				name:        "active_no_ttl",
 				ttl:         nil,
-				status:      true,
+				status:      adspots.StatusActive,
 				shouldShow:  true,
 				description: "Active ad with no TTL should always show",
 			},
 			{
 				name:        "active_within_ttl",
 				ttl:         intPtr(120), // 2 hours
-				status:      true,
+				status:      adspots.StatusActive,
 				shouldShow:  true,
 				description: "Active ad within TTL should show",
 			},
 			{
 				name:        "active_expired",
 				ttl:         intPtr(30), // 30 minutes
-				status:      true,
+				status:      adspots.StatusActive,
 				shouldShow:  false,
 				description: "Active ad past TTL should be filtered out",
 			},
 			{
 				name:        "inactive",
 				ttl:         nil, // 30 minutes
-				status:      false,
+				status:      adspots.StatusDeactivated,
 				shouldShow:  false,
 				description: "Inactive ad should not be shown no matter what",
 			},
 		}
 
 		for _, tc := range testCases {
-			st := adspots.Status(tc.status)
 			ad := adspots.AdSpot{
 				ID:         tc.name,
 				Title:      "Test ad: " + tc.name,
@@ -79,7 +103,7 @@ func TestFiltering(t *testing.T) {
 				TTLMinutes: tc.ttl,
 				Placement:  adspots.PlacementHomeScreen,
 				CreatedAt:  adspots.ISO8601(time.Now()),
-				Status:     &st,
+				Status:     tc.status,
 			}
 			err := gorm.G[adspots.AdSpot](db).Create(t.Context(), &ad)
 			if err != nil {
@@ -97,11 +121,12 @@ func TestFiltering(t *testing.T) {
 			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
 		}
 
-		var adspots []adspots.AdSpot
-		err = json.Unmarshal(w.Body.Bytes(), &adspots)
+		var response adspots.ListResponse
+		err = json.Unmarshal(w.Body.Bytes(), &response)
 		if err != nil {
 			t.Fatalf("Failed to parse response: %v", err)
 		}
+		adspots := response.Data
 
 		expectedCount := 0
 		for _, tc := range testCases {
@@ -0,0 +1,112 @@
+package t
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestFlights(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
+
+		now := time.Now()
+		spot := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+			"title":     "Next week",
+			"imageUrl":  "https://example.com/a.png",
+			"placement": "home_screen",
+			"startAt":   adspots.ISO8601(now.Add(1 * time.Hour)),
+			"endAt":     adspots.ISO8601(now.Add(2 * time.Hour)),
+		})))
+
+		steps := []struct {
+			wait        time.Duration
+			effective   adspots.EffectiveStatus
+			served      bool
+			description string
+		}{
+			{0, adspots.EffectiveScheduled, false, "Ad spots are scheduled until their flight starts"},
+			{1 * time.Hour, adspots.EffectiveActive, true, "Ad spots are active during their flight"},
+			{1*time.Hour + time.Second, adspots.EffectiveExpired, false, "Ad spots expire when their flight ends"},
+		}
+
+		for _, step := range steps {
+			time.Sleep(step.wait)
+
+			if got := getAdSpot(t, server, spot.ID, "").EffectiveStatus(); got != step.effective {
+				t.Errorf("[%s] Expected effective status %s, got %s", step.description, step.effective, got)
+			}
+
+			_, code := serveAdSpot(t, server, "placement=home_screen")
+			if served := code == http.StatusOK; served != step.served {
+				t.Errorf("[%s] Expected served to be %v, got %d", step.description, step.served, code)
+			}
+
+			for _, status := range []adspots.EffectiveStatus{adspots.EffectiveScheduled, adspots.EffectiveActive, adspots.EffectiveExpired} {
+				listed := len(listAdSpots(t, server, url.Values{"status": {string(status)}}).Data) == 1
+				if listed != (status == step.effective) {
+					t.Errorf("[%s] Unexpected result for status=%s filter: listed=%v", step.description, status, listed)
+				}
+			}
+		}
+	})
+}
+
+func TestFlightValidation(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{
+		"title":     "Backwards",
+		"imageUrl":  "https://example.com/a.png",
+		"placement": "home_screen",
+		"startAt":   "2030-01-02T00:00:00+0000",
+		"endAt":     "2030-01-01T00:00:00+0000",
+	}))
+	w := httptest.NewRecorder()
+	server.CreateAdSpot(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an end date before the start date, got %d", w.Code)
+	}
+}
+
+func TestFlightDatesInUTC(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{
+		"title":     "Offset",
+		"imageUrl":  "https://example.com/a.png",
+		"placement": "home_screen",
+		"startAt":   "2030-01-01T10:00:00+0200",
+		"endAt":     "2030-01-02T10:00:00+0200",
+	}))
+	w := httptest.NewRecorder()
+	server.CreateAdSpot(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, expected := range []string{`"startAt":"2030-01-01T08:00:00+0000"`, `"endAt":"2030-01-02T08:00:00+0000"`, `"expiresAt":"2030-01-02T08:00:00+0000"`} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Expected the flight dates in UTC, with %s, got %s", expected, w.Body.String())
+		}
+	}
+}
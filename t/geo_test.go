@@ -0,0 +1,159 @@
+package t
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestGeoTargeting(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	// A 2 km circle around Times Square
+	circle := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+		"title":     "Midtown",
+		"imageUrl":  "https://example.com/a.png",
+		"placement": "map_view",
+		"geo": map[string]any{
+			"center":       map[string]float64{"lat": 40.758, "lng": -73.9855},
+			"radiusMeters": 2000,
+		},
+	})))
+	// Lower Manhattan, with a hole around Battery Park
+	polygon := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+		"title":     "Downtown",
+		"imageUrl":  "https://example.com/a.png",
+		"placement": "map_view",
+		"geo": map[string]any{
+			"polygon": map[string]any{
+				"type": "Polygon",
+				"coordinates": [][][2]float64{
+					{{-74.03, 40.69}, {-73.97, 40.69}, {-73.97, 40.73}, {-74.03, 40.73}, {-74.03, 40.69}},
+					{{-74.02, 40.70}, {-74.01, 40.70}, {-74.01, 40.705}, {-74.02, 40.705}, {-74.02, 40.70}},
+				},
+			},
+		},
+	})))
+	global := createAdSpot(t, server, `{"title":"Everywhere","imageUrl":"https://example.com/a.png","placement":"map_view"}`)
+
+	for _, tc := range []struct {
+		name     string
+		lat, lng string
+		expected []string
+	}{
+		{"Times Square", "40.7580", "-73.9855", []string{global.ID, circle.ID}},
+		{"Wall Street", "40.7060", "-74.0090", []string{global.ID, polygon.ID}},
+		{"Battery Park", "40.7025", "-74.0150", []string{global.ID}},
+		{"Paris", "48.8566", "2.3522", []string{global.ID}},
+	} {
+		response := listAdSpots(t, server, url.Values{"lat": {tc.lat}, "lng": {tc.lng}})
+		var ids []string
+		for _, spot := range response.Data {
+			ids = append(ids, spot.ID)
+		}
+		if len(ids) != len(tc.expected) {
+			t.Errorf("%s: expected %d ad spots, got %d", tc.name, len(tc.expected), len(ids))
+		}
+		for _, id := range tc.expected {
+			if !slices.Contains(ids, id) {
+				t.Errorf("%s: expected ad spot %s to be listed", tc.name, id)
+			}
+		}
+
+		for range 10 {
+			spot, code := serveAdSpot(t, server, "placement=map_view&lat="+tc.lat+"&lng="+tc.lng)
+			if code != http.StatusOK || !slices.Contains(tc.expected, spot.ID) {
+				t.Errorf("%s: served unexpected ad spot %s with %d", tc.name, spot.ID, code)
+			}
+		}
+	}
+
+	// Without a location, only untargeted ad spots can be served
+	for range 10 {
+		if spot, code := serveAdSpot(t, server, "placement=map_view"); code != http.StatusOK || spot.ID != global.ID {
+			t.Errorf("Expected only the untargeted ad spot to be served, got %s with %d", spot.ID, code)
+		}
+	}
+
+	// Moving the circle must be picked up right away
+	req := httptest.NewRequest("PATCH", "/adspots/"+circle.ID, jsonBody(map[string]any{
+		"geo": map[string]any{"center": map[string]float64{"lat": 48.8566, "lng": 2.3522}},
+	}))
+	req.SetPathValue("id", circle.ID)
+	w := httptest.NewRecorder()
+	server.PatchAdSpot(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if response := listAdSpots(t, server, url.Values{"lat": {"48.8566"}, "lng": {"2.3522"}}); len(response.Data) != 2 {
+		t.Errorf("Expected the moved ad spot to be listed in Paris, got %d ad spots", len(response.Data))
+	}
+}
+
+func TestGeoIndexRace(t *testing.T) {
+	db := setupDatabase(t)
+	store := &racingStore{Store: adspots.NewGormStore(db)}
+	server := adspots.NewServer(store)
+	defer server.Close()
+
+	store.matches = func(filter adspots.AdSpotFilter) bool { return filter.GeoTargeted }
+	store.race = func() {
+		createAdSpot(t, server, `{"title":"Raced","imageUrl":"https://example.com/a.png","placement":"home_screen","geo":{"center":{"lat":40.758,"lng":-73.9855},"radiusMeters":2000}}`)
+	}
+	if _, code := serveAdSpot(t, server, "placement=home_screen&lat=40.758&lng=-73.9855"); code != http.StatusNoContent {
+		t.Fatalf("Expected the racing build to find nothing, got %d", code)
+	}
+	if spot, code := serveAdSpot(t, server, "placement=home_screen&lat=40.758&lng=-73.9855"); code != http.StatusOK || spot.Title != "Raced" {
+		t.Errorf("Expected the ad spot created during the build to be served, got %d", code)
+	}
+}
+
+func TestGeoValidation(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	for _, geo := range []map[string]any{
+		{},
+		{"center": map[string]float64{"lat": 40, "lng": -73}},
+		{"center": map[string]float64{"lat": 91, "lng": -73}, "radiusMeters": 1000},
+		{"center": map[string]float64{"lat": 40, "lng": -73}, "radiusMeters": -5},
+		{"polygon": map[string]any{"type": "Point", "coordinates": [][][2]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}}},
+		{"polygon": map[string]any{"type": "Polygon", "coordinates": [][][2]float64{{{0, 0}, {1, 0}, {1, 1}}}}},
+		{"polygon": map[string]any{"type": "Polygon", "coordinates": [][][2]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}}}}},
+		{
+			"center":       map[string]float64{"lat": 40, "lng": -73},
+			"radiusMeters": 1000,
+			"polygon":      map[string]any{"type": "Polygon", "coordinates": [][][2]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}},
+		},
+	} {
+		req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{
+			"title":     "Invalid",
+			"imageUrl":  "https://example.com/a.png",
+			"placement": "map_view",
+			"geo":       geo,
+		}))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for geo target %v, got %d", geo, w.Code)
+		}
+	}
+
+	for _, query := range []string{"lat=40", "lng=-73", "lat=abc&lng=-73", "lat=40&lng=200"} {
+		req := httptest.NewRequest("GET", "/serve?placement=map_view&"+query, nil)
+		w := httptest.NewRecorder()
+		server.ServeAdSpot(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", query, w.Code)
+		}
+	}
+}
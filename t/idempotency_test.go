@@ -0,0 +1,121 @@
+package t
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		server.Mux().ServeHTTP(w, req)
+		return w
+	}
+	countAdSpots := func() int64 {
+		count, err := gorm.G[adspots.AdSpot](db).Count(t.Context(), "*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	body := `{"title":"Retried","imageUrl":"https://example.com/a.png","placement":"home_screen"}`
+	first := post("/adspots", "create-1", body)
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", first.Code, first.Body.String())
+	}
+	var spot adspots.AdSpot
+	if err := json.Unmarshal(first.Body.Bytes(), &spot); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	// The same JSON, formatted differently, is the same request
+	retried := post("/adspots", "create-1", `{"placement": "home_screen", "imageUrl": "https://example.com/a.png", "title": "Retried"}`)
+	if retried.Code != http.StatusOK || retried.Body.String() != first.Body.String() {
+		t.Errorf("Expected the first response to be replayed, got %d: %s", retried.Code, retried.Body.String())
+	}
+	if retried.Header().Get("Idempotent-Replayed") != "true" || retried.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Errorf("Expected the replay to be flagged and keep the ETag, got %v", retried.Header())
+	}
+	if count := countAdSpots(); count != 1 {
+		t.Errorf("Expected retries to create 1 ad spot, got %d", count)
+	}
+
+	steps := []struct {
+		path        string
+		key         string
+		body        string
+		code        int
+		description string
+	}{
+		{"/adspots", "create-1", `{"title":"Other","imageUrl":"https://example.com/a.png","placement":"home_screen"}`, http.StatusUnprocessableEntity, "Keys can't be reused for another body"},
+		{"/campaigns", "create-1", body, http.StatusUnprocessableEntity, "Keys can't be reused for another route"},
+		{"/adspots", "invalid-1", `{"title":"Invalid"}`, http.StatusBadRequest, "Client errors are answered"},
+		{"/adspots", "invalid-1", `{"title":"Invalid"}`, http.StatusBadRequest, "Client errors are replayed"},
+		{"/adspots/" + spot.ID + "/deactivate", "deactivate-1", "", http.StatusOK, "Transitions are recorded"},
+		{"/adspots/" + spot.ID + "/deactivate", "deactivate-1", "", http.StatusOK, "Retried transitions are replayed rather than rejected"},
+		{"/adspots/" + spot.ID + "/deactivate", "", "", http.StatusConflict, "Requests without keys run again"},
+		{"/adspots", strings.Repeat("k", 256), body, http.StatusBadRequest, "Keys are bounded in length"},
+	}
+	for _, step := range steps {
+		if w := post(step.path, step.key, step.body); w.Code != step.code {
+			t.Errorf("[%s] Expected %d, got %d: %s", step.description, step.code, w.Code, w.Body.String())
+		}
+	}
+
+	if w := post("/adspots", "", body); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if count := countAdSpots(); count != 2 {
+		t.Errorf("Expected a request without a key to create another ad spot, got %d", count)
+	}
+}
+
+func TestIdempotencyKeysInProgress(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	body := `{"title":"Held","imageUrl":"https://example.com/a.png","placement":"home_screen"}`
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/adspots", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		server.Mux().ServeHTTP(w, req)
+		return w
+	}
+
+	// Turn the records of two requests back into reservations, as if one was
+	// still being handled and the other was abandoned long ago
+	now := time.Now().UTC()
+	for key, at := range map[string]time.Time{"pending": now, "abandoned": now.Add(-time.Hour)} {
+		if w := send(key); w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		err := db.Exec("UPDATE idempotency_keys SET status_code = 0, created_at = ? WHERE key = ?", at, key).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for key, code := range map[string]int{"pending": http.StatusConflict, "abandoned": http.StatusOK} {
+		if w := send(key); w.Code != code {
+			t.Errorf("Expected %d for the %s key, got %d: %s", code, key, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package t
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestLifecycle(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, `{"title":"Lifecycle","imageUrl":"https://example.com/a.png","placement":"ride_summary","status":"draft"}`)
+	if spot.Status != adspots.StatusDraft {
+		t.Fatalf("Expected new ad spot to be a draft, got %s", spot.Status)
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"activate":   server.ActivateAdSpot,
+		"pause":      server.PauseAdSpot,
+		"deactivate": server.DeactivateAdSpot,
+		"archive":    server.ArchiveAdSpot,
+	}
+
+	steps := []struct {
+		action      string
+		code        int
+		status      adspots.Status
+		description string
+	}{
+		{"pause", http.StatusConflict, adspots.StatusDraft, "Drafts cannot be paused"},
+		{"activate", http.StatusOK, adspots.StatusActive, "Drafts can be activated"},
+		{"pause", http.StatusOK, adspots.StatusPaused, "Active ad spots can be paused"},
+		{"activate", http.StatusOK, adspots.StatusActive, "Paused ad spots can be resumed"},
+		{"deactivate", http.StatusOK, adspots.StatusDeactivated, "Active ad spots can be deactivated"},
+		{"deactivate", http.StatusConflict, adspots.StatusDeactivated, "Deactivating twice is not allowed"},
+		{"activate", http.StatusOK, adspots.StatusActive, "Deactivated ad spots can be reactivated"},
+		{"archive", http.StatusConflict, adspots.StatusActive, "Active ad spots must be deactivated before archival"},
+		{"deactivate", http.StatusOK, adspots.StatusDeactivated, "Reactivated ad spots can be deactivated again"},
+		{"archive", http.StatusOK, adspots.StatusArchived, "Deactivated ad spots can be archived"},
+		{"activate", http.StatusConflict, adspots.StatusArchived, "Archived ad spots are terminal"},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest("POST", "/adspots/"+spot.ID+"/"+step.action, nil)
+		req.SetPathValue("id", spot.ID)
+		w := httptest.NewRecorder()
+		handlers[step.action](w, req)
+
+		if w.Code != step.code {
+			t.Fatalf("[%s] Expected %d, got %d: %s", step.description, step.code, w.Code, w.Body.String())
+		}
+
+		if step.code == http.StatusConflict {
+			var body struct {
+				Error map[string]string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if body.Error["current"] != step.status.String() || body.Error["requested"] == "" {
+				t.Errorf("[%s] Conflict response should name both states, got %v", step.description, body.Error)
+			}
+		}
+
+		req = httptest.NewRequest("GET", "/adspots/"+spot.ID, nil)
+		req.SetPathValue("id", spot.ID)
+		w = httptest.NewRecorder()
+		server.GetAdSpot(w, req)
+
+		var got adspots.AdSpot
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if got.Status != step.status {
+			t.Errorf("[%s] Expected status %s, got %s", step.description, step.status, got.Status)
+		}
+		if (got.DeactivatedAt != nil) != (step.status == adspots.StatusDeactivated || step.status == adspots.StatusArchived) {
+			t.Errorf("[%s] Unexpected deactivation date %v for status %s", step.description, got.DeactivatedAt, got.Status)
+		}
+	}
+}
+
+func TestLifecycleRejectsInitialStatus(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	for _, status := range []string{"paused", "deactivated", "archived"} {
+		req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{
+			"title":     "Lifecycle",
+			"imageUrl":  "https://example.com/a.png",
+			"placement": "ride_summary",
+			"status":    status,
+		}))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 creating a %s ad spot, got %d", status, w.Code)
+		}
+	}
+}
+
+func TestStatusScan(t *testing.T) {
+	for _, tc := range []struct {
+		value    any
+		expected adspots.Status
+		err      error
+	}{
+		{"paused", adspots.StatusPaused, nil},
+		{[]byte("archived"), adspots.StatusArchived, nil},
+		{int64(1), adspots.StatusActive, nil},
+		{int64(0), adspots.StatusDeactivated, nil},
+		{true, adspots.StatusActive, nil},
+		{int64(2), 0, adspots.InvalidStatus},
+		{"on", 0, adspots.InvalidStatus},
+	} {
+		var status adspots.Status
+		err := status.Scan(tc.value)
+		if !errors.Is(err, tc.err) || (err == nil && status != tc.expected) {
+			t.Errorf("Expected %v to scan as %v (%v), got %v (%v)", tc.value, tc.expected, tc.err, status, err)
+		}
+	}
+}
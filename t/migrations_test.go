@@ -0,0 +1,334 @@
+package t
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+func TestMigrations(t *testing.T) {
+	db := openDatabase(t)
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations := migrator.Migrations()
+
+	if err := migrator.Check(t.Context()); !errors.Is(err, adspots.UnmigratedDatabase) {
+		t.Errorf("Expected an empty database to be unmigrated, got %v", err)
+	}
+	if _, err := migrator.Down(t.Context()); !errors.Is(err, adspots.NoAppliedMigrations) {
+		t.Errorf("Expected nothing to revert on an empty database, got %v", err)
+	}
+
+	ran, err := migrator.Up(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(migrations) {
+		t.Errorf("Expected %d migrations to run, got %d", len(migrations), len(ran))
+	}
+	if err := migrator.Check(t.Context()); err != nil {
+		t.Errorf("Expected a migrated database to pass the check, got %v", err)
+	}
+	if ran, err := migrator.Up(t.Context()); err != nil || len(ran) != 0 {
+		t.Errorf("Expected migrating again to do nothing, got %d migrations: %v", len(ran), err)
+	}
+
+	reverted, err := migrator.Down(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest := migrations[len(migrations)-1]; reverted.Version != latest.Version {
+		t.Errorf("Expected migration %d to be reverted, got %d", latest.Version, reverted.Version)
+	}
+	if err := migrator.Check(t.Context()); !errors.Is(err, adspots.UnmigratedDatabase) {
+		t.Errorf("Expected a partially migrated database to fail the check, got %v", err)
+	}
+
+	statuses, err := migrator.Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != len(migrations) {
+		t.Fatalf("Expected a status for each of %d migrations, got %d", len(migrations), len(statuses))
+	}
+	for i, status := range statuses {
+		pending := i == len(statuses)-1
+		if (status.AppliedAt == nil) != pending {
+			t.Errorf("Expected migration %d to be pending: %v, got applied at %v", status.Version, pending, status.AppliedAt)
+		}
+	}
+
+	for range migrations[1:] {
+		if _, err := migrator.Down(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.Migrator().HasTable(&adspots.AdSpot{}) {
+		t.Error("Expected reverting every migration to drop the tables")
+	}
+}
+
+func TestMigrationsConvertDates(t *testing.T) {
+	db := openDatabase(t)
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Roll back to the initial schema, and store a date the way it used to be
+	for range migrator.Migrations()[1:] {
+		if _, err := migrator.Down(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.Exec("INSERT INTO ad_spots (id, title, image_url, placement, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		"legacy", "Legacy", "https://example.com/a.png", adspots.PlacementHomeScreen, adspots.StatusActive, "2024-01-02T03:04:05+0200").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := db.Raw("SELECT CAST(created_at AS TEXT) FROM ad_spots WHERE id = ?", "legacy").Scan(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored != "2024-01-02 01:04:05+00:00" {
+		t.Errorf("Expected the date to be stored in UTC, got %q", stored)
+	}
+
+	spot, err := adspots.NewGormStore(db).Get(t.Context(), "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2024, 1, 2, 1, 4, 5, 0, time.UTC)
+	if created := time.Time(spot.CreatedAt); !created.Equal(expected) {
+		t.Errorf("Expected the ad spot to be created at %v, got %v", expected, created)
+	}
+}
+
+func TestMigrationsBackfillExpiry(t *testing.T) {
+	db := openDatabase(t)
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Roll back to before the backfill, and store ad spots the way they were
+	// before their expiry dates were
+	for {
+		reverted, err := migrator.Down(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reverted.Name == "backfill_expires_at" {
+			break
+		}
+	}
+	now := time.Now()
+	legacy := []struct {
+		id        string
+		createdAt time.Time
+		ttl       any
+		endAt     any
+	}{
+		{"expired", now.Add(-2 * time.Hour), 60, nil},
+		{"ended", now.Add(-2 * time.Hour), 600, adspots.ISO8601(now.Add(-time.Hour))},
+		{"live", now, 60, nil},
+		{"forever", now.Add(-2 * time.Hour), nil, nil},
+	}
+	for _, spot := range legacy {
+		err := db.Exec("INSERT INTO ad_spots (id, title, image_url, placement, status, ttl_minutes, created_at, end_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			spot.id, "Legacy", "https://example.com/a.png", adspots.PlacementHomeScreen, adspots.StatusActive, spot.ttl, adspots.ISO8601(spot.createdAt), spot.endAt).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := adspots.LoadPlacements(t.Context(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	for status, expected := range map[string][]string{"expired": {"ended", "expired"}, "active": {"forever", "live"}} {
+		var got []string
+		for _, spot := range listAdSpots(t, server, url.Values{"status": {status}}).Data {
+			got = append(got, spot.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, expected) {
+			t.Errorf("Expected status=%s to return %v, got %v", status, expected, got)
+		}
+	}
+}
+
+func TestMigrationsBackfillExpiryFromBaseline(t *testing.T) {
+	db := openBaselineDatabase(t)
+	for id, ttl := range map[string]any{"ttl": 60, "zero": 0, "none": nil} {
+		err := db.Exec("INSERT INTO ad_spots (id, title, image_url, placement, status, ttl_minutes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			id, "Legacy", "https://example.com/a.png", adspots.PlacementHomeScreen, 1, ttl, "2024-01-02T03:04:05+0200").Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	store := adspots.NewGormStore(db)
+	expected := time.Date(2024, 1, 2, 2, 4, 5, 0, time.UTC)
+	for id, expires := range map[string]bool{"ttl": true, "zero": false, "none": false} {
+		spot, err := store.Get(t.Context(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case !expires && spot.ExpiresAt != nil:
+			t.Errorf("Expected the %s ad spot never to expire, got %v", id, spot.ExpiresAt)
+		case expires && (spot.ExpiresAt == nil || !time.Time(*spot.ExpiresAt).Equal(expected)):
+			t.Errorf("Expected the %s ad spot to expire at %v, got %v", id, expected, spot.ExpiresAt)
+		}
+	}
+}
+
+func TestMigrationsLegacyStatuses(t *testing.T) {
+	db := openBaselineDatabase(t)
+	for id, status := range map[string]bool{"on": true, "off": false} {
+		err := db.Exec("INSERT INTO ad_spots (id, title, image_url, placement, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			id, "Legacy", "https://example.com/a.png", adspots.PlacementHomeScreen, status, "2024-01-02T03:04:05+0200").Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []struct {
+		ID     string
+		Status string
+	}
+	if err := db.Raw("SELECT id, CAST(status AS TEXT) AS status FROM ad_spots ORDER BY id").Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprint([]string{"off deactivated", "on active"})
+	var got []string
+	for _, row := range rows {
+		got = append(got, row.ID+" "+row.Status)
+	}
+	if fmt.Sprint(got) != expected {
+		t.Errorf("Expected statuses %v, got %v", expected, got)
+	}
+
+	if err := adspots.LoadPlacements(t.Context(), db); err != nil {
+		t.Fatal(err)
+	}
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+	var active []string
+	for _, spot := range listAdSpots(t, server, url.Values{"status": {"active"}}).Data {
+		active = append(active, spot.ID)
+	}
+	if !slices.Equal(active, []string{"on"}) {
+		t.Errorf("Expected status=active to return [on], got %v", active)
+	}
+}
+
+// baselineSchema is the ad_spots table as db.AutoMigrate created it in the
+// first release, which stored statuses as booleans and dates as text.
+const baselineSchema = "CREATE TABLE `ad_spots` (`id` text,`title` text,`image_url` text,`placement` integer,`status` numeric,`ttl_minutes` integer,`created_at` text,`deactivated_at` text,PRIMARY KEY (`id`))"
+
+// openBaselineDatabase returns a database set up by the first release, before
+// migrations.
+func openBaselineDatabase(t *testing.T) *gorm.DB {
+	db := openDatabase(t)
+	if err := db.Exec(baselineSchema).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrationsAdoptAutoMigrate(t *testing.T) {
+	db := openBaselineDatabase(t)
+	err := db.Exec("INSERT INTO ad_spots (id, title, image_url, placement, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		"legacy", "Legacy", "https://example.com/a.png", adspots.PlacementHomeScreen, 1, "2024-01-02T03:04:05+0200").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Check(t.Context()); !errors.Is(err, adspots.UnmigratedDatabase) {
+		t.Errorf("Expected a database set up by AutoMigrate to be unmigrated, got %v", err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatalf("Failed to migrate a database set up by AutoMigrate: %v", err)
+	}
+	if err := adspots.LoadPlacements(t.Context(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	if spot := getAdSpot(t, server, "legacy", ""); spot.Title != "Legacy" {
+		t.Errorf("Expected the ad spot of the first release to be kept, got %+v", spot)
+	}
+	req := httptest.NewRequest("POST", "/adspots", strings.NewReader(`{"title":"Adopted","imageUrl":"https://example.com/a.png","placement":"home_screen"}`))
+	w := httptest.NewRecorder()
+	server.CreateAdSpot(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 creating an ad spot, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMigrationsUnknownVersion(t *testing.T) {
+	db := setupDatabase(t)
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", 9999, "future", time.Now().UTC()).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Check(t.Context()); !errors.Is(err, adspots.UnknownMigration) {
+		t.Errorf("Expected a database from a newer version to fail the check, got %v", err)
+	}
+	if _, err := migrator.Down(t.Context()); !errors.Is(err, adspots.UnknownMigration) {
+		t.Errorf("Expected an unknown migration not to be reverted, got %v", err)
+	}
+}
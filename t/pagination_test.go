@@ -0,0 +1,97 @@
+package t
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+func listAdSpots(t *testing.T, server *adspots.Server, query url.Values) adspots.ListResponse {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/adspots?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.ListAdSpots(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response adspots.ListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return response
+}
+
+func TestPagination(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	// Half of the ad spots share a creation date, so ordering must fall back
+	// to the ID to stay stable.
+	now := time.Now()
+	for i := range 8 {
+		ad := adspots.AdSpot{
+			ID:        fmt.Sprintf("spot-%d", i),
+			Title:     "Paginated",
+			ImageURL:  "https://example.com/image.png",
+			Placement: adspots.PlacementHomeScreen,
+			Status:    adspots.StatusActive,
+			CreatedAt: adspots.ISO8601(now.Add(-time.Duration(i/4) * time.Minute)),
+		}
+		if err := gorm.G[adspots.AdSpot](db).Create(t.Context(), &ad); err != nil {
+			t.Fatalf("Failed to insert ad spot: %v", err)
+		}
+	}
+
+	expected := []string{"spot-3", "spot-2", "spot-1", "spot-0", "spot-7", "spot-6", "spot-5", "spot-4"}
+
+	var seen []string
+	query := url.Values{"limit": {"3"}}
+	for pages := 1; ; pages++ {
+		response := listAdSpots(t, server, query)
+		for _, ad := range response.Data {
+			seen = append(seen, ad.ID)
+		}
+
+		if response.NextCursor == nil {
+			if pages != 3 {
+				t.Errorf("Expected 3 pages, got %d", pages)
+			}
+			break
+		}
+		if pages > 3 {
+			t.Fatalf("Pagination did not terminate, seen %v", seen)
+		}
+		query.Set("cursor", *response.NextCursor)
+	}
+
+	if fmt.Sprint(seen) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, seen)
+	}
+}
+
+func TestPaginationInvalidParameters(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	for _, query := range []string{"limit=0", "limit=abc", "limit=1000", "cursor=not-a-cursor"} {
+		req := httptest.NewRequest("GET", "/adspots?"+query, nil)
+		w := httptest.NewRecorder()
+		server.ListAdSpots(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", query, w.Code)
+		}
+	}
+}
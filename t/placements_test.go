@@ -0,0 +1,192 @@
+package t
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+func TestPlacements(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	created := createResource[adspots.PlacementConfig](t, server.CreatePlacement, "/placements", map[string]any{
+		"name":              "checkout_banner",
+		"description":       "Banner on the checkout screen",
+		"allowedDimensions": []map[string]int{{"width": 320, "height": 50}},
+	})
+	if created.Name != "checkout_banner" || len(created.AllowedDimensions) != 1 {
+		t.Errorf("Unexpected placement: %+v", created)
+	}
+
+	req := httptest.NewRequest("GET", "/placements", nil)
+	w := httptest.NewRecorder()
+	server.ListPlacements(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var list struct {
+		Data []adspots.PlacementConfig `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	var names []string
+	for _, placement := range list.Data {
+		names = append(names, placement.Name)
+	}
+	if len(names) != 4 || names[0] != "home_screen" || names[1] != "ride_summary" || names[2] != "map_view" || names[3] != "checkout_banner" {
+		t.Errorf("Expected the built-in placements followed by the new one, got %v", names)
+	}
+
+	// Built-in placements keep their IDs
+	var builtin adspots.Placement
+	if err := builtin.Parse("map_view"); err != nil || builtin != adspots.PlacementMapView {
+		t.Errorf("Expected map_view to parse to %d, got %d (%v)", adspots.PlacementMapView, builtin, err)
+	}
+
+	// The new placement can be used right away, by images of allowed sizes
+	for _, size := range []string{``, `,"imageSize":{"width":300,"height":250}`} {
+		req := httptest.NewRequest("POST", "/adspots", strings.NewReader(`{"title":"Checkout","imageUrl":"https://example.com/a.png","placement":"checkout_banner"`+size+`}`))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an image size the placement doesn't allow (%q), got %d", size, w.Code)
+		}
+	}
+	spot := createAdSpot(t, server, `{"title":"Checkout","imageUrl":"https://example.com/a.png","imageSize":{"width":320,"height":50},"placement":"checkout_banner"}`)
+	req = httptest.NewRequest("GET", "/adspots/"+spot.ID, nil)
+	req.SetPathValue("id", spot.ID)
+	w = httptest.NewRecorder()
+	server.GetAdSpot(w, req)
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if body["placement"] != "checkout_banner" {
+		t.Errorf("Expected placement checkout_banner, got %v", body["placement"])
+	}
+	served, code := serveAdSpot(t, server, "placement=checkout_banner")
+	if code != http.StatusOK || served.ID != spot.ID {
+		t.Errorf("Expected the checkout ad spot to be served, got %d %s", code, served.ID)
+	}
+
+	req = httptest.NewRequest("POST", "/placements", jsonBody(map[string]any{"name": "checkout_banner"}))
+	w = httptest.NewRecorder()
+	server.CreatePlacement(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate name, got %d", w.Code)
+	}
+}
+
+func TestPlacementValidation(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	for _, body := range []map[string]any{
+		{},
+		{"name": "Home Screen"},
+		{"name": "footer", "allowedDimensions": []map[string]int{{"width": 0, "height": 50}}},
+		{"name": "footer", "maxActiveAds": 0},
+	} {
+		req := httptest.NewRequest("POST", "/placements", jsonBody(body))
+		w := httptest.NewRecorder()
+		server.CreatePlacement(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %v, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestPlacementMaxActiveAds(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	createResource[adspots.PlacementConfig](t, server.CreatePlacement, "/placements", map[string]any{
+		"name":         "splash",
+		"maxActiveAds": 1,
+	})
+
+	first := createAdSpot(t, server, `{"title":"First","imageUrl":"https://example.com/a.png","placement":"splash"}`)
+	second := createAdSpot(t, server, `{"title":"Second","imageUrl":"https://example.com/a.png","placement":"splash","status":"draft"}`)
+
+	req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{"title": "Third", "imageUrl": "https://example.com/a.png", "placement": "splash"}))
+	w := httptest.NewRecorder()
+	server.CreateAdSpot(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when creating an active ad spot in a full placement, got %d", w.Code)
+	}
+
+	transition := func(handler http.HandlerFunc, id string) int {
+		req := httptest.NewRequest("POST", "/adspots/"+id, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+	if code := transition(server.ActivateAdSpot, second.ID); code != http.StatusConflict {
+		t.Errorf("Expected 409 when activating an ad spot in a full placement, got %d", code)
+	}
+	if code := transition(server.PauseAdSpot, first.ID); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if code := transition(server.ActivateAdSpot, second.ID); code != http.StatusOK {
+		t.Errorf("Expected 200 once the placement has room, got %d", code)
+	}
+}
+
+func TestPlacementsPerServer(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db, other := setupDatabase(t), setupDatabase(t)
+		for _, db := range []*gorm.DB{db, other} {
+			sqlDB, err := db.DB()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sqlDB.Close()
+		}
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
+		otherServer := adspots.NewServer(adspots.NewGormStore(other))
+		defer otherServer.Close()
+
+		// Both databases give their first placement the same ID
+		createResource[adspots.PlacementConfig](t, server.CreatePlacement, "/placements", map[string]any{"name": "checkout_banner"})
+		createResource[adspots.PlacementConfig](t, otherServer.CreatePlacement, "/placements", map[string]any{"name": "splash"})
+
+		create := func(server *adspots.Server, placement string) int {
+			req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{"title": "Placed", "imageUrl": "https://example.com/a.png", "placement": placement}))
+			w := httptest.NewRecorder()
+			server.CreateAdSpot(w, req)
+			return w.Code
+		}
+		if code := create(server, "splash"); code != http.StatusBadRequest {
+			t.Errorf("Expected placements of another database to be unknown, got %d", code)
+		}
+		if code := create(server, "checkout_banner"); code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", code)
+		}
+
+		// Placements created by another process are found once the server
+		// looks for them again
+		err := db.Exec("INSERT INTO placements (id, name, description, created_at) VALUES (?, ?, ?, ?)", 100, "footer", "", adspots.ISO8601(time.Now())).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Second)
+		if code := create(server, "footer"); code != http.StatusOK {
+			t.Errorf("Expected a placement created elsewhere to be found, got %d", code)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package t
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+// setupPostgres connects to the database named by ADSPOTS_POSTGRES_DSN, and
+// recreates its schema through the migrations. Tests using it are skipped without one.
+func setupPostgres(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("ADSPOTS_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("ADSPOTS_POSTGRES_DSN is not set")
+	}
+
+	db, err := adspots.OpenDatabase(adspots.DriverPostgres, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrator().DropTable(append(models, "schema_migrations")...); err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := adspots.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := adspots.LoadPlacements(t.Context(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPostgresGormStore(t *testing.T) {
+	testStore(t, func(t *testing.T) (adspots.AdSpotStore, adspots.CampaignStore) {
+		store := adspots.NewGormStore(setupPostgres(t))
+		return store, store
+	})
+}
+
+func TestPostgresSQLStore(t *testing.T) {
+	testStore(t, func(t *testing.T) (adspots.AdSpotStore, adspots.CampaignStore) {
+		db := setupPostgres(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return adspots.NewSQLStore(sqlDB, adspots.DriverPostgres), adspots.NewGormStore(db)
+	})
+}
+
+func TestPostgresServer(t *testing.T) {
+	db := setupPostgres(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, `{"title":"Postgres","imageUrl":"https://example.com/a.png","placement":"home_screen","ttlMinutes":60,"maxImpressions":10}`)
+	if served, code := serveAdSpot(t, server, "placement=home_screen&clientId=rider"); code != http.StatusOK || served.ID != spot.ID {
+		t.Errorf("Expected the ad spot to be served, got %d %s", code, served.ID)
+	}
+	if code := recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider"}); code != http.StatusCreated {
+		t.Errorf("Expected 201, got %d", code)
+	}
+	if spot := getAdSpot(t, server, spot.ID, "clientId=rider"); spot.CapState == nil || spot.CapState.Impressions != 1 {
+		t.Errorf("Expected the impression to be counted, got %+v", spot.CapState)
+	}
+}
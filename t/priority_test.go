@@ -0,0 +1,118 @@
+package t
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+func TestPriorityServing(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	house := createAdSpot(t, server, `{"title":"House","imageUrl":"https://example.com/a.png","placement":"home_screen"}`)
+	heavy := createAdSpot(t, server, `{"title":"Heavy","imageUrl":"https://example.com/a.png","placement":"home_screen","priority":10,"weight":3}`)
+	light := createAdSpot(t, server, `{"title":"Light","imageUrl":"https://example.com/a.png","placement":"home_screen","priority":10}`)
+	if light.Weight != 1 || house.Priority != 0 {
+		t.Errorf("Expected a default weight of 1 and priority of 0, got %d and %d", light.Weight, house.Priority)
+	}
+
+	// The house ad is never served while paid ads are eligible, and the paid
+	// ads share impressions according to their weight
+	served := map[string]int{}
+	for range 400 {
+		spot, code := serveAdSpot(t, server, "placement=home_screen")
+		if code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		served[spot.ID]++
+	}
+	if served[house.ID] != 0 {
+		t.Errorf("Expected the house ad not to be served, got %d impressions", served[house.ID])
+	}
+	if served[heavy.ID] < 250 || served[heavy.ID] > 350 {
+		t.Errorf("Expected the heavy ad to get about 300 of 400 impressions, got %d", served[heavy.ID])
+	}
+
+	for _, id := range []string{heavy.ID, light.ID} {
+		req := httptest.NewRequest("POST", "/adspots/"+id+"/pause", nil)
+		req.SetPathValue("id", id)
+		server.PauseAdSpot(httptest.NewRecorder(), req)
+	}
+	if spot, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusOK || spot.ID != house.ID {
+		t.Errorf("Expected the house ad to be served once paid ads are paused, got %s with %d", spot.ID, code)
+	}
+
+	for _, weight := range []int{0, -1, adspots.MaxWeight + 1} {
+		req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{
+			"title":     "Invalid",
+			"imageUrl":  "https://example.com/a.png",
+			"placement": "home_screen",
+			"weight":    weight,
+		}))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for weight %d, got %d", weight, w.Code)
+		}
+	}
+}
+
+func TestPrioritySorting(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	now := time.Now()
+	for i := range 6 {
+		ad := adspots.AdSpot{
+			ID:        fmt.Sprintf("spot-%d", i),
+			Title:     "Sorted",
+			ImageURL:  "https://example.com/image.png",
+			Placement: adspots.PlacementHomeScreen,
+			Status:    adspots.StatusActive,
+			Priority:  i % 3,
+			Weight:    1,
+			CreatedAt: adspots.ISO8601(now.Add(time.Duration(i) * time.Minute)),
+		}
+		if err := gorm.G[adspots.AdSpot](db).Create(t.Context(), &ad); err != nil {
+			t.Fatalf("Failed to insert ad spot: %v", err)
+		}
+	}
+
+	expected := []string{"spot-5", "spot-2", "spot-4", "spot-1", "spot-3", "spot-0"}
+
+	var seen []string
+	query := url.Values{"limit": {"4"}, "sort": {"priority"}}
+	for {
+		response := listAdSpots(t, server, query)
+		for _, ad := range response.Data {
+			seen = append(seen, ad.ID)
+		}
+		if response.NextCursor == nil || len(seen) > len(expected) {
+			break
+		}
+		query.Set("cursor", *response.NextCursor)
+	}
+	if fmt.Sprint(seen) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, seen)
+	}
+
+	// A cursor only makes sense in the order it was issued for
+	first := listAdSpots(t, server, url.Values{"limit": {"1"}, "sort": {"priority"}})
+	for _, query := range []string{"sort=newest", "cursor=" + *first.NextCursor} {
+		req := httptest.NewRequest("GET", "/adspots?"+query, nil)
+		w := httptest.NewRecorder()
+		server.ListAdSpots(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", query, w.Code)
+		}
+	}
+}
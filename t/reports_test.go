@@ -0,0 +1,143 @@
+package t
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestReports(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
+
+		home := createAdSpot(t, server, `{"title":"Home","imageUrl":"https://example.com/a.png","placement":"home_screen"}`)
+		mapView := createAdSpot(t, server, `{"title":"Map","imageUrl":"https://example.com/a.png","placement":"map_view"}`)
+
+		events := []map[string]any{
+			{"adSpotId": home.ID, "type": "impression", "timestamp": "2000-01-01T10:05:00+0000"},
+			{"adSpotId": mapView.ID, "type": "impression", "timestamp": "2000-01-01T10:05:00+0000"},
+			{"adSpotId": home.ID, "type": "impression", "timestamp": "2000-01-01T10:15:00+0000"},
+			{"adSpotId": home.ID, "type": "impression", "timestamp": "2000-01-01T07:30:00-0300"},
+			{"adSpotId": home.ID, "type": "click", "timestamp": "2000-01-01T10:45:00+0000"},
+			{"adSpotId": home.ID, "type": "impression", "timestamp": "2000-01-01T11:05:00+0000"},
+			{"adSpotId": home.ID, "type": "impression", "timestamp": "2000-01-02T09:00:00+0000"},
+		}
+
+		// Events too far from the current time are rejected, so they are
+		// recorded as their timestamps come. The bubble's clock starts on
+		// 2000-01-01 at midnight UTC.
+		for i, event := range events {
+			event["eventId"] = fmt.Sprint("event-", i)
+			event["clientId"] = "rider"
+
+			at, err := time.Parse("2006-01-02T15:04:05-0700", event["timestamp"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Until(at))
+
+			req := httptest.NewRequest("POST", "/events", jsonBody(map[string]any{"events": []any{event}}))
+			w := httptest.NewRecorder()
+			server.RecordEvents(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+		}
+
+		stats := func(query url.Values) adspots.AdSpotStats {
+			t.Helper()
+
+			req := httptest.NewRequest("GET", "/adspots/"+home.ID+"/stats?"+query.Encode(), nil)
+			req.SetPathValue("id", home.ID)
+			w := httptest.NewRecorder()
+			server.AdSpotStats(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var stats adspots.AdSpotStats
+			if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			return stats
+		}
+
+		hourly := stats(url.Values{
+			"from":        {"2000-01-01T10:00:00+0000"},
+			"to":          {"2000-01-01T12:00:00+0000"},
+			"granularity": {"hour"},
+		})
+		if len(hourly.Buckets) != 2 {
+			t.Fatalf("Expected 2 hourly buckets, got %d", len(hourly.Buckets))
+		}
+		if got := hourly.Buckets[0].Counts; got.Impressions != 3 || got.Clicks != 1 || got.CTR != 1.0/3 {
+			t.Errorf("Unexpected counts for the first hour: %+v", got)
+		}
+		if got := hourly.Buckets[1].Counts; got.Impressions != 1 || got.Clicks != 0 || got.CTR != 0 {
+			t.Errorf("Unexpected counts for the second hour: %+v", got)
+		}
+
+		daily := stats(url.Values{
+			"from":        {"2000-01-01T00:00:00+0000"},
+			"to":          {"2000-01-03T00:00:00+0000"},
+			"granularity": {"day"},
+		})
+		if len(daily.Buckets) != 2 {
+			t.Fatalf("Expected 2 daily buckets, got %d", len(daily.Buckets))
+		}
+		if daily.Buckets[0].Impressions != 4 || daily.Buckets[1].Impressions != 1 || daily.Totals.Impressions != 5 || daily.Totals.Clicks != 1 {
+			t.Errorf("Unexpected daily counts: %+v, totals %+v", daily.Buckets, daily.Totals)
+		}
+
+		for _, query := range []string{"granularity=week", "from=yesterday", "from=2000-01-01T00:00:00%2B0000&to=1999-01-01T00:00:00%2B0000"} {
+			req := httptest.NewRequest("GET", "/adspots/"+home.ID+"/stats?"+query, nil)
+			req.SetPathValue("id", home.ID)
+			w := httptest.NewRecorder()
+			server.AdSpotStats(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400 for %q, got %d", query, w.Code)
+			}
+		}
+
+		req := httptest.NewRequest("GET", "/reports/placements?"+url.Values{
+			"from": {"2000-01-01T00:00:00+0000"},
+			"to":   {"2000-01-03T00:00:00+0000"},
+		}.Encode(), nil)
+		w := httptest.NewRecorder()
+		server.PlacementReport(w, req)
+
+		var report struct {
+			Data []struct {
+				Placement   string `json:"placement"`
+				Impressions int64  `json:"impressions"`
+				Clicks      int64  `json:"clicks"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		expected := fmt.Sprint([]any{"home_screen", 5, 1, "map_view", 1, 0})
+		var got []any
+		for _, row := range report.Data {
+			got = append(got, row.Placement, row.Impressions, row.Clicks)
+		}
+		if fmt.Sprint(got) != expected {
+			t.Errorf("Expected placement report %v, got %v", expected, got)
+		}
+	})
+}
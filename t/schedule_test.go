@@ -0,0 +1,198 @@
+package t
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestSchedulePreview(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	spot := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+		"title":     "Commute",
+		"imageUrl":  "https://example.com/a.png",
+		"placement": "ride_summary",
+		"schedule": map[string]any{
+			"timezone": "America/New_York",
+			"windows": []map[string]any{
+				{"days": []string{"mon", "tue", "wed", "thu", "fri"}, "start": "07:00", "end": "09:00"},
+				{"days": []string{"fri"}, "start": "22:00", "end": "24:00"},
+				{"days": []string{"sat"}, "start": "00:00", "end": "02:00"},
+			},
+		},
+	})))
+
+	query := url.Values{
+		"from": {"2025-01-06T00:00:00-0500"},
+		"to":   {"2025-01-11T12:00:00-0500"},
+	}
+	req := httptest.NewRequest("GET", "/adspots/"+spot.ID+"/schedule/preview?"+query.Encode(), nil)
+	req.SetPathValue("id", spot.ID)
+	w := httptest.NewRecorder()
+	server.PreviewSchedule(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var preview struct {
+		Windows []adspots.LiveWindow `json:"windows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	expected := []string{
+		"2025-01-06T07:00:00-0500 2025-01-06T09:00:00-0500",
+		"2025-01-07T07:00:00-0500 2025-01-07T09:00:00-0500",
+		"2025-01-08T07:00:00-0500 2025-01-08T09:00:00-0500",
+		"2025-01-09T07:00:00-0500 2025-01-09T09:00:00-0500",
+		"2025-01-10T07:00:00-0500 2025-01-10T09:00:00-0500",
+		"2025-01-10T22:00:00-0500 2025-01-11T02:00:00-0500",
+	}
+	if len(preview.Windows) != len(expected) {
+		t.Fatalf("Expected %d windows, got %d: %v", len(expected), len(preview.Windows), preview.Windows)
+	}
+	for i, window := range preview.Windows {
+		start := time.Time(window.Start).In(time.FixedZone("", -5*60*60))
+		end := time.Time(window.End).In(time.FixedZone("", -5*60*60))
+		if got := adspots.ISO8601(start).String() + " " + adspots.ISO8601(end).String(); got != expected[i] {
+			t.Errorf("Expected window %q, got %q", expected[i], got)
+		}
+	}
+}
+
+func TestScheduleServing(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
+
+		// The bubble's clock starts on Saturday, 2000-01-01 at midnight UTC
+		createAdSpot(t, server, `{"title":"Night owls","imageUrl":"https://example.com/a.png","placement":"home_screen","schedule":{"timezone":"UTC","windows":[{"days":["sat"],"start":"01:00","end":"02:00"}]}}`)
+
+		for _, served := range []bool{false, true, false} {
+			if _, code := serveAdSpot(t, server, "placement=home_screen"); (code == http.StatusOK) != served {
+				t.Errorf("At %v, expected served to be %v, got %d", time.Now().UTC(), served, code)
+			}
+			time.Sleep(1 * time.Hour)
+		}
+	})
+}
+
+func TestScheduleOvernight(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		server := adspots.NewServer(adspots.NewGormStore(db))
+		defer server.Close()
+
+		// The bubble's clock starts on Saturday, 2000-01-01 at midnight UTC,
+		// within Friday's window. Ad spots off their schedule are listed as
+		// scheduled, and fill pages that the limit must look past.
+		always := createAdSpot(t, server, `{"title":"Always","imageUrl":"https://example.com/a.png","placement":"home_screen"}`)
+		overnight := createAdSpot(t, server, `{"title":"Overnight","imageUrl":"https://example.com/a.png","placement":"home_screen","schedule":{"timezone":"UTC","windows":[{"days":["fri"],"start":"23:00","end":"01:00"}]}}`)
+		var offSchedule []string
+		for range 3 {
+			spot := createAdSpot(t, server, `{"title":"Weekdays","imageUrl":"https://example.com/a.png","placement":"home_screen","schedule":{"timezone":"UTC","windows":[{"days":["mon"],"start":"09:00","end":"17:00"}]}}`)
+			offSchedule = append(offSchedule, spot.ID)
+		}
+
+		listed := func(query url.Values) []string {
+			var ids []string
+			for _, spot := range listAdSpots(t, server, query).Data {
+				ids = append(ids, spot.ID)
+			}
+			slices.Sort(ids)
+			return ids
+		}
+		sorted := func(ids ...string) []string {
+			slices.Sort(ids)
+			return ids
+		}
+
+		for _, step := range []struct {
+			scheduled []string
+			active    []string
+		}{
+			{offSchedule, []string{always.ID, overnight.ID}},
+			{append([]string{overnight.ID}, offSchedule...), []string{always.ID}},
+		} {
+			if got := listed(url.Values{"status": {"scheduled"}}); !slices.Equal(got, sorted(step.scheduled...)) {
+				t.Errorf("At %v, expected %v to be scheduled, got %v", time.Now().UTC(), sorted(step.scheduled...), got)
+			}
+			if got := listed(url.Values{"status": {"active"}}); !slices.Equal(got, sorted(step.active...)) {
+				t.Errorf("At %v, expected %v to be active, got %v", time.Now().UTC(), sorted(step.active...), got)
+			}
+			if got := listed(url.Values{"status": {"active"}, "limit": {"1"}}); len(got) != 1 {
+				t.Errorf("At %v, expected a page of 1 active ad spot, got %v", time.Now().UTC(), got)
+			}
+			time.Sleep(time.Hour)
+		}
+
+		req := httptest.NewRequest("GET", "/adspots/"+overnight.ID+"/schedule/preview", nil)
+		req.SetPathValue("id", overnight.ID)
+		w := httptest.NewRecorder()
+		server.PreviewSchedule(w, req)
+
+		var preview struct {
+			Windows []adspots.LiveWindow `json:"windows"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if len(preview.Windows) != 1 || preview.Windows[0].Start.String() != "2000-01-07T23:00:00+0000" || preview.Windows[0].End.String() != "2000-01-08T01:00:00+0000" {
+			t.Errorf("Expected the window to run past midnight, got %v", preview.Windows)
+		}
+	})
+}
+
+func TestScheduleValidation(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	for _, schedule := range []map[string]any{
+		{"timezone": "Mars/Olympus_Mons", "windows": []map[string]any{{"days": []string{"mon"}, "start": "07:00", "end": "09:00"}}},
+		{"timezone": "UTC", "windows": []map[string]any{}},
+		{"timezone": "UTC", "windows": []map[string]any{{"days": []string{"monday"}, "start": "07:00", "end": "09:00"}}},
+		{"timezone": "UTC", "windows": []map[string]any{{"days": []string{"mon"}, "start": "7:00", "end": "09:00"}}},
+		{"timezone": "UTC", "windows": []map[string]any{{"days": []string{"mon"}, "start": "07:00", "end": "07:00"}}},
+		{"timezone": "UTC", "windows": []map[string]any{{"days": []string{"mon"}, "start": "24:00", "end": "02:00"}}},
+		{"timezone": "UTC", "windows": []map[string]any{{"days": []string{"mon"}, "start": "07:00", "end": "24:30"}}},
+	} {
+		req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{
+			"title":     "Invalid",
+			"imageUrl":  "https://example.com/a.png",
+			"placement": "home_screen",
+			"schedule":  schedule,
+		}))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for schedule %v, got %d", schedule, w.Code)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package t
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func serveAdSpot(t *testing.T, server *adspots.Server, query string) (adspots.AdSpot, int) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/serve?"+query, nil)
+	w := httptest.NewRecorder()
+	server.ServeAdSpot(w, req)
+
+	var spot adspots.AdSpot
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+	}
+	return spot, w.Code
+}
+
+func TestServe(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+	server.SetSelector(adspots.NewRoundRobinSelector())
+
+	eligible := map[string]bool{}
+	for range 3 {
+		spot := createAdSpot(t, server, `{"title":"Eligible","imageUrl":"https://example.com/a.png","placement":"ride_summary"}`)
+		eligible[spot.ID] = true
+	}
+	createAdSpot(t, server, `{"title":"Other placement","imageUrl":"https://example.com/a.png","placement":"map_view"}`)
+	createAdSpot(t, server, `{"title":"Draft","imageUrl":"https://example.com/a.png","placement":"ride_summary","status":"draft"}`)
+
+	// Round robin should go through every eligible ad spot before repeating
+	seen := map[string]int{}
+	for range 6 {
+		spot, code := serveAdSpot(t, server, "placement=ride_summary")
+		if code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		if !eligible[spot.ID] {
+			t.Fatalf("Served ineligible ad spot %s (%s)", spot.ID, spot.Title)
+		}
+		seen[spot.ID]++
+	}
+	for id := range eligible {
+		if seen[id] != 2 {
+			t.Errorf("Expected ad spot %s to be served twice, got %d", id, seen[id])
+		}
+	}
+
+	// Deactivating an ad spot must be reflected despite the cache
+	for id := range eligible {
+		req := httptest.NewRequest("POST", "/adspots/"+id+"/deactivate", nil)
+		req.SetPathValue("id", id)
+		server.DeactivateAdSpot(httptest.NewRecorder(), req)
+	}
+	if _, code := serveAdSpot(t, server, "placement=ride_summary"); code != http.StatusNoContent {
+		t.Errorf("Expected 204 once every ad spot is deactivated, got %d", code)
+	}
+
+	if _, code := serveAdSpot(t, server, "placement=nowhere"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid placement, got %d", code)
+	}
+}
+
+func TestWeightedSelector(t *testing.T) {
+	candidates := []adspots.AdSpot{{ID: "never"}, {ID: "always"}}
+	selector := adspots.WeightedSelector{
+		Weight: func(a adspots.AdSpot) int {
+			if a.ID == "always" {
+				return 1
+			}
+			return 0
+		},
+	}
+
+	for range 100 {
+		if spot := selector.Select(adspots.PlacementHomeScreen, candidates); spot.ID != "always" {
+			t.Fatalf("Selected ad spot %s despite its weight of zero", spot.ID)
+		}
+	}
+
+	// Without a weight function, the Weight field of the ad spots is used
+	candidates = []adspots.AdSpot{{ID: "never", Weight: 0}, {ID: "always", Weight: 1}}
+	for range 100 {
+		if spot := (adspots.WeightedSelector{}).Select(adspots.PlacementHomeScreen, candidates); spot.ID != "always" {
+			t.Fatalf("Selected ad spot %s despite its weight of zero", spot.ID)
+		}
+	}
+}
+
+// racingStore calls race once, during the first list whose filter it
+// matches, after the database was read.
+type racingStore struct {
+	adspots.Store
+	matches func(adspots.AdSpotFilter) bool
+	race    func()
+}
+
+func (rs *racingStore) List(ctx context.Context, filter adspots.AdSpotFilter) ([]adspots.AdSpot, error) {
+	spots, err := rs.Store.List(ctx, filter)
+	if race := rs.race; race != nil && rs.matches(filter) {
+		rs.race = nil
+		race()
+	}
+	return spots, err
+}
+
+func TestServeCacheRace(t *testing.T) {
+	db := setupDatabase(t)
+	store := &racingStore{Store: adspots.NewGormStore(db)}
+	server := adspots.NewServer(store)
+	defer server.Close()
+
+	// The eligible ad spots are the ones listed by placement
+	store.matches = func(filter adspots.AdSpotFilter) bool { return filter.Placement != nil }
+	store.race = func() {
+		createAdSpot(t, server, `{"title":"Raced","imageUrl":"https://example.com/a.png","placement":"home_screen"}`)
+	}
+	if _, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusNoContent {
+		t.Fatalf("Expected the racing load to find nothing, got %d", code)
+	}
+	if spot, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusOK || spot.Title != "Raced" {
+		t.Errorf("Expected the ad spot created during the load to be served, got %d", code)
+	}
+}
@@ -0,0 +1,202 @@
+package t
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+// Servers behave alike whatever their store. The memory store runs them
+// without any database.
+func TestServerWithGormStore(t *testing.T) {
+	testServer(t, func(t *testing.T) adspots.Store {
+		return adspots.NewGormStore(setupDatabase(t))
+	})
+}
+
+func TestServerWithSQLStore(t *testing.T) {
+	testServer(t, func(t *testing.T) adspots.Store {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return adspots.WithAdSpots(adspots.NewGormStore(db), adspots.NewSQLStore(sqlDB, adspots.DriverSQLite))
+	})
+}
+
+func TestServerWithMemoryStore(t *testing.T) {
+	testServer(t, func(t *testing.T) adspots.Store {
+		return adspots.NewMemoryStore()
+	})
+}
+
+func testServer(t *testing.T, newStore func(t *testing.T) adspots.Store) {
+	newServer := func(t *testing.T) *adspots.Server {
+		server := adspots.NewServer(newStore(t))
+		t.Cleanup(server.Close)
+		return server
+	}
+	get := func(t *testing.T, handler http.HandlerFunc, path, id string, v any) {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", path, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+	}
+
+	t.Run("campaigns", func(t *testing.T) {
+		server := newServer(t)
+
+		acme := createResource[adspots.Advertiser](t, server.CreateAdvertiser, "/advertisers", map[string]any{"name": "Acme"})
+		campaign := createResource[adspots.Campaign](t, server.CreateCampaign, "/campaigns", map[string]any{
+			"advertiserId":         acme.ID,
+			"name":                 "Spring sale",
+			"lifetimeBudgetMicros": 1000000,
+			"pricing":              "cpm",
+			"rateMicros":           2000,
+		})
+		spot := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+			"title":      "Acme",
+			"imageUrl":   "https://example.com/a.png",
+			"placement":  "home_screen",
+			"campaignId": campaign.ID,
+		})))
+
+		if response := listAdSpots(t, server, url.Values{"campaignId": {campaign.ID}}); len(response.Data) != 1 || response.Data[0].ID != spot.ID {
+			t.Errorf("Expected the campaign's ad spot to be listed, got %+v", response.Data)
+		}
+		if served, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusOK || served.ID != spot.ID {
+			t.Errorf("Expected the ad spot to be served, got %d %s", code, served.ID)
+		}
+		if code := recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider"}); code != http.StatusCreated {
+			t.Errorf("Expected 201 for the impression, got %d", code)
+		}
+		if got := getCampaign(t, server, campaign.ID); got.Budget == nil || got.Budget.LifetimeMicros != 2 {
+			t.Errorf("Expected the impression to be charged, got %+v", got.Budget)
+		}
+
+		req := httptest.NewRequest("PATCH", "/campaigns/"+campaign.ID, jsonBody(map[string]any{"status": "paused"}))
+		req.SetPathValue("id", campaign.ID)
+		w := httptest.NewRecorder()
+		server.PatchCampaign(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if _, code := serveAdSpot(t, server, "placement=home_screen"); code != http.StatusNoContent {
+			t.Errorf("Expected the paused campaign's ad spot not to be served, got %d", code)
+		}
+
+		var advertisers struct{ Data []adspots.Advertiser }
+		get(t, server.ListAdvertisers, "/advertisers", "", &advertisers)
+		if len(advertisers.Data) != 1 || advertisers.Data[0].Name != "Acme" {
+			t.Errorf("Expected the advertiser to be listed, got %+v", advertisers.Data)
+		}
+		req = httptest.NewRequest("DELETE", "/advertisers/"+acme.ID, nil)
+		req.SetPathValue("id", acme.ID)
+		w = httptest.NewRecorder()
+		server.DeleteAdvertiser(w, req)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected 409 deleting an advertiser with campaigns, got %d", w.Code)
+		}
+	})
+
+	t.Run("caps", func(t *testing.T) {
+		server := newServer(t)
+
+		spot := createAdSpot(t, server, `{"title":"Capped","imageUrl":"https://example.com/a.png","placement":"ride_summary","frequencyCap":{"count":1,"windowMinutes":60}}`)
+		if _, code := serveAdSpot(t, server, "placement=ride_summary&clientId=rider-1"); code != http.StatusOK {
+			t.Fatalf("Expected 200 before the first impression, got %d", code)
+		}
+		recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider-1"})
+		if _, code := serveAdSpot(t, server, "placement=ride_summary&clientId=rider-1"); code != http.StatusNoContent {
+			t.Errorf("Expected 204 for a client that reached the frequency cap, got %d", code)
+		}
+		if got := getAdSpot(t, server, spot.ID, "clientId=rider-1"); got.CapState == nil || got.CapState.Impressions != 1 || !got.CapState.FrequencyCapped {
+			t.Errorf("Expected a frequency capped state, got %+v", got.CapState)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		server := newServer(t)
+
+		spot := createAdSpot(t, server, `{"title":"Tracked","imageUrl":"https://example.com/a.png","placement":"map_view","creatives":[{"id":"a","title":"A","imageUrl":"https://example.com/a.png"}]}`)
+		recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider", "creativeId": "a"})
+		recordEvent(t, server, spot.ID, adspots.EventClick, map[string]any{"eventId": "e2", "clientId": "rider", "creativeId": "a"})
+		// Retried events are only counted once
+		recordEvent(t, server, spot.ID, adspots.EventImpression, map[string]any{"eventId": "e1", "clientId": "rider", "creativeId": "a"})
+
+		var stats adspots.AdSpotStats
+		get(t, server.AdSpotStats, "/adspots/"+spot.ID+"/stats", spot.ID, &stats)
+		if stats.Totals.Impressions != 1 || stats.Totals.Clicks != 1 {
+			t.Errorf("Expected 1 impression and 1 click, got %+v", stats.Totals)
+		}
+		if len(stats.Creatives) != 1 || stats.Creatives[0].CreativeID != "a" || stats.Creatives[0].Impressions != 1 {
+			t.Errorf("Expected the creative's impression, got %+v", stats.Creatives)
+		}
+
+		var report adspots.PlacementReport
+		get(t, server.PlacementReport, "/reports/placements", "", &report)
+		if len(report.Data) != 1 || report.Data[0].Placement != "map_view" || report.Data[0].Clicks != 1 {
+			t.Errorf("Expected the map view to be reported, got %+v", report.Data)
+		}
+	})
+
+	t.Run("placements", func(t *testing.T) {
+		server := newServer(t)
+
+		created := createResource[adspots.PlacementConfig](t, server.CreatePlacement, "/placements", map[string]any{"name": "checkout", "maxActiveAds": 1})
+		createAdSpot(t, server, `{"title":"Checkout","imageUrl":"https://example.com/a.png","placement":"checkout"}`)
+
+		var placements struct{ Data []adspots.PlacementConfig }
+		get(t, server.ListPlacements, "/placements", "", &placements)
+		if len(placements.Data) != 4 || placements.Data[3].Name != created.Name {
+			t.Errorf("Expected the built-in placements and the new one, got %+v", placements.Data)
+		}
+
+		req := httptest.NewRequest("POST", "/adspots", strings.NewReader(`{"title":"Full","imageUrl":"https://example.com/a.png","placement":"checkout"}`))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected 409 once the placement is full, got %d", w.Code)
+		}
+		req = httptest.NewRequest("POST", "/placements", strings.NewReader(`{"name":"checkout"}`))
+		w = httptest.NewRecorder()
+		server.CreatePlacement(w, req)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected 409 for a taken name, got %d", w.Code)
+		}
+	})
+
+	t.Run("idempotency", func(t *testing.T) {
+		server := newServer(t)
+
+		post := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/adspots", strings.NewReader(`{"title":"Retried","imageUrl":"https://example.com/a.png","placement":"home_screen"}`))
+			req.Header.Set("Idempotency-Key", "create-1")
+			w := httptest.NewRecorder()
+			server.Mux().ServeHTTP(w, req)
+			return w
+		}
+		first := post()
+		retried := post()
+		if retried.Code != first.Code || retried.Body.String() != first.Body.String() || retried.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("Expected the first response to be replayed, got %d: %s", retried.Code, retried.Body.String())
+		}
+		if response := listAdSpots(t, server, url.Values{}); len(response.Data) != 1 {
+			t.Errorf("Expected a single ad spot, got %d", len(response.Data))
+		}
+	})
+}
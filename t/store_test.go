@@ -0,0 +1,471 @@
+package t
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+// Every store runs the same suite, so that they stay interchangeable.
+// Each store comes with the store its ad spots read campaigns from.
+func TestGormStore(t *testing.T) {
+	testStore(t, func(t *testing.T) (adspots.AdSpotStore, adspots.CampaignStore) {
+		store := adspots.NewGormStore(setupDatabase(t))
+		return store, store
+	})
+}
+
+func TestSQLStore(t *testing.T) {
+	testStore(t, func(t *testing.T) (adspots.AdSpotStore, adspots.CampaignStore) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return adspots.NewSQLStore(sqlDB, adspots.DriverSQLite), adspots.NewGormStore(db)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) (adspots.AdSpotStore, adspots.CampaignStore) {
+		store := adspots.NewMemoryStore()
+		return store, store
+	})
+}
+
+func ids(spots []adspots.AdSpot) []string {
+	var result []string
+	for _, spot := range spots {
+		result = append(result, spot.ID)
+	}
+	return result
+}
+
+func testStore(t *testing.T, newStore func(t *testing.T) (adspots.AdSpotStore, adspots.CampaignStore)) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *adspots.ISO8601 {
+		tm := adspots.ISO8601(now.Add(d))
+		return &tm
+	}
+	campaign := "campaign"
+	newSpot := func(id string, created time.Duration) adspots.AdSpot {
+		return adspots.AdSpot{
+			ID:        id,
+			Title:     "Title " + id,
+			ImageURL:  "https://example.com/" + id + ".png",
+			Placement: adspots.PlacementHomeScreen,
+			Weight:    1,
+			Status:    adspots.StatusActive,
+			CreatedAt: *at(created),
+		}
+	}
+
+	// seed stores a spread of ad spots, one per effective status and more
+	seed := func(t *testing.T, store adspots.AdSpotStore) {
+		live := newSpot("live", -time.Hour)
+		live.Priority = 1
+		live.Targeting = &adspots.Targeting{Key: "city", In: []string{"nyc"}}
+		live.Creatives = []adspots.Creative{{ID: "a", Title: "A", ImageURL: "https://example.com/a.png", Weight: 2}}
+		live.ImageSize = &adspots.Dimensions{Width: 320, Height: 50}
+
+		scheduled := newSpot("scheduled", -2*time.Hour)
+		scheduled.StartAt = at(time.Hour)
+		scheduled.CampaignID = &campaign
+
+		expired := newSpot("expired", -3*time.Hour)
+		expired.EndAt = at(-time.Minute)
+
+		paused := newSpot("paused", -4*time.Hour)
+		paused.Status = adspots.StatusPaused
+		paused.Placement = adspots.PlacementMapView
+		paused.TTLMinutes = intPtr(60 * 24)
+		paused.FrequencyCap = &adspots.FrequencyCap{Count: 3, WindowMinutes: 60}
+
+		radius := 1000.0
+		geo := newSpot("geo", -5*time.Hour)
+		geo.Priority = 1
+		geo.CampaignID = &campaign
+		geo.Geo = &adspots.GeoTarget{Center: &adspots.GeoPoint{Lat: 40.7, Lng: -74}, RadiusMeters: &radius}
+
+		for _, spot := range []adspots.AdSpot{live, scheduled, expired, paused, geo} {
+			if err := store.Create(t.Context(), spot); err != nil {
+				t.Fatalf("Failed to create %s: %v", spot.ID, err)
+			}
+		}
+	}
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		store, _ := newStore(t)
+		seed(t, store)
+
+		spot, err := store.Get(t.Context(), "live")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spot.Title != "Title live" || spot.Priority != 1 || spot.Status != adspots.StatusActive || spot.CreatedAt.String() != at(-time.Hour).String() {
+			t.Errorf("Unexpected ad spot: %+v", spot)
+		}
+		if spot.Targeting == nil || spot.Targeting.Key != "city" || len(spot.Creatives) != 1 || spot.Creatives[0].Weight != 2 || spot.ImageSize == nil || spot.ImageSize.Width != 320 {
+			t.Errorf("Expected JSON fields to round trip, got %+v %+v %+v", spot.Targeting, spot.Creatives, spot.ImageSize)
+		}
+
+		paused, err := store.Get(t.Context(), "paused")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paused.ExpiresAt == nil || paused.ExpiresAt.String() != at(20*time.Hour).String() {
+			t.Errorf("Expected the expiry to be derived from the TTL, got %v", paused.ExpiresAt)
+		}
+		if paused.FrequencyCap == nil || paused.FrequencyCap.Count != 3 || paused.Placement != adspots.PlacementMapView {
+			t.Errorf("Unexpected ad spot: %+v", paused)
+		}
+
+		if _, err := store.Get(t.Context(), "missing"); !errors.Is(err, adspots.AdSpotNotFound) {
+			t.Errorf("Expected AdSpotNotFound, got %v", err)
+		}
+		if err := store.Create(t.Context(), newSpot("live", 0)); err == nil {
+			t.Error("Expected creating a duplicate ID to fail")
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		store, _ := newStore(t)
+		seed(t, store)
+
+		spot, _ := store.Get(t.Context(), "live")
+		spot.Title = "Renamed"
+		spot.Targeting = nil
+		spot.Status = adspots.StatusArchived
+		spot.CreatedAt = *at(0)
+		if err := store.Update(t.Context(), spot); err != nil {
+			t.Fatal(err)
+		}
+
+		spot, _ = store.Get(t.Context(), "live")
+		if spot.Title != "Renamed" || spot.Targeting != nil {
+			t.Errorf("Expected editable fields to be updated, got %+v", spot)
+		}
+		if spot.Status != adspots.StatusActive || spot.CreatedAt.String() != at(-time.Hour).String() {
+			t.Errorf("Expected status and creation date to be kept, got %s %s", spot.Status, spot.CreatedAt)
+		}
+
+		if err := store.Update(t.Context(), newSpot("missing", 0)); !errors.Is(err, adspots.AdSpotNotFound) {
+			t.Errorf("Expected AdSpotNotFound, got %v", err)
+		}
+	})
+
+	t.Run("UpdateStatus", func(t *testing.T) {
+		store, _ := newStore(t)
+		seed(t, store)
+
+		spot, _ := store.Get(t.Context(), "live")
+		spot.Status = adspots.StatusDeactivated
+		spot.DeactivatedAt = at(0)
+		spot.DeactivationReason = adspots.DeactivationManual
+		spot.Title = "Ignored"
+
+		if updated, err := store.UpdateStatus(t.Context(), spot, adspots.StatusPaused); err != nil || updated {
+			t.Errorf("Expected no update from the wrong status, got %v %v", updated, err)
+		}
+		if updated, err := store.UpdateStatus(t.Context(), spot, adspots.StatusActive); err != nil || !updated {
+			t.Errorf("Expected an update, got %v %v", updated, err)
+		}
+
+		spot, _ = store.Get(t.Context(), "live")
+		if spot.Status != adspots.StatusDeactivated || spot.DeactivatedAt == nil || spot.DeactivationReason != adspots.DeactivationManual {
+			t.Errorf("Expected the ad spot to be deactivated, got %+v", spot)
+		}
+		if spot.Title != "Title live" {
+			t.Errorf("Expected only the status to change, got title %q", spot.Title)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		store, campaigns := newStore(t)
+		seed(t, store)
+		err := campaigns.CreateCampaign(t.Context(), adspots.Campaign{ID: campaign, Name: "Paused", Status: adspots.StatusPaused, CreatedAt: *at(0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		home, mapView := adspots.PlacementHomeScreen, adspots.PlacementMapView
+		paused := adspots.StatusPaused
+		for _, tc := range []struct {
+			name     string
+			filter   adspots.AdSpotFilter
+			expected []string
+		}{
+			{"everything newest first", adspots.AdSpotFilter{}, []string{"live", "scheduled", "expired", "paused", "geo"}},
+			{"by ID", adspots.AdSpotFilter{IDs: []string{"geo", "live", "missing"}}, []string{"live", "geo"}},
+			{"by placement", adspots.AdSpotFilter{Placement: &mapView}, []string{"paused"}},
+			{"by campaign", adspots.AdSpotFilter{CampaignID: &campaign}, []string{"scheduled", "geo"}},
+			{"by status", adspots.AdSpotFilter{Status: &paused}, []string{"paused"}},
+			{"active", adspots.AdSpotFilter{Now: now, Effective: []adspots.EffectiveStatus{adspots.EffectiveActive}}, []string{"live", "geo"}},
+			{"scheduled", adspots.AdSpotFilter{Now: now, Effective: []adspots.EffectiveStatus{adspots.EffectiveScheduled}}, []string{"scheduled"}},
+			{"expired", adspots.AdSpotFilter{Now: now, Effective: []adspots.EffectiveStatus{adspots.EffectiveExpired}}, []string{"expired"}},
+			{"inactive", adspots.AdSpotFilter{Now: now, Effective: []adspots.EffectiveStatus{adspots.EffectiveInactive}}, []string{"paused"}},
+			{"later on", adspots.AdSpotFilter{Now: now.Add(2 * time.Hour), Effective: []adspots.EffectiveStatus{adspots.EffectiveActive}}, []string{"live", "scheduled", "geo"}},
+			{"active campaigns", adspots.AdSpotFilter{Placement: &home, ActiveCampaigns: true}, []string{"live", "expired"}},
+			{"geo targeted", adspots.AdSpotFilter{GeoTargeted: true}, []string{"geo"}},
+			{"outside the geo target", adspots.AdSpotFilter{Placement: &home, GeoPoint: &adspots.GeoPoint{Lat: 40.7, Lng: -73.98}}, []string{"live", "scheduled", "expired"}},
+			{"inside the geo target", adspots.AdSpotFilter{Placement: &home, GeoPoint: &adspots.GeoPoint{Lat: 40.7, Lng: -74}}, []string{"live", "scheduled", "expired", "geo"}},
+			{"inside the geo target, limited", adspots.AdSpotFilter{GeoPoint: &adspots.GeoPoint{Lat: 40.7, Lng: -74}, Limit: 1}, []string{"live"}},
+			{"limited", adspots.AdSpotFilter{Limit: 2}, []string{"live", "scheduled"}},
+			{"by priority", adspots.AdSpotFilter{Sort: adspots.SortPriority}, []string{"live", "geo", "scheduled", "expired", "paused"}},
+		} {
+			spots, err := store.List(t.Context(), tc.filter)
+			if err != nil {
+				t.Fatalf("[%s] %v", tc.name, err)
+			}
+			if got := ids(spots); !slices.Equal(got, tc.expected) {
+				t.Errorf("[%s] Expected %v, got %v", tc.name, tc.expected, got)
+			}
+		}
+
+		spots, err := store.List(t.Context(), adspots.AdSpotFilter{IDs: []string{"live", "geo"}})
+		if err != nil || len(spots) != 2 || spots[0].CampaignInactive || !spots[1].CampaignInactive {
+			t.Errorf("Expected only the geo ad spot's campaign to be inactive, got %+v %v", spots, err)
+		}
+		if spot, err := store.Get(t.Context(), "scheduled"); err != nil || !spot.CampaignInactive {
+			t.Errorf("Expected the scheduled ad spot's campaign to be inactive, got %v", err)
+		}
+	})
+
+	t.Run("Schedules", func(t *testing.T) {
+		store, _ := newStore(t)
+		// now is a Sunday, off the schedule, which the newest ad spots have
+		schedule := &adspots.Schedule{Timezone: "UTC", Windows: []adspots.ScheduleWindow{{Days: []string{"mon"}, Start: "09:00", End: "10:00"}}}
+		for i, id := range []string{"always", "monday", "mondays"} {
+			spot := newSpot(id, time.Duration(i)*time.Minute)
+			if id != "always" {
+				spot.Schedule = schedule
+			}
+			if err := store.Create(t.Context(), spot); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		monday := now.Add(21*time.Hour + 30*time.Minute)
+		for _, tc := range []struct {
+			name     string
+			filter   adspots.AdSpotFilter
+			expected []string
+		}{
+			{"active", adspots.AdSpotFilter{Now: now, Effective: []adspots.EffectiveStatus{adspots.EffectiveActive}}, []string{"always"}},
+			{"active past full pages", adspots.AdSpotFilter{Now: now, Effective: []adspots.EffectiveStatus{adspots.EffectiveActive}, Limit: 1}, []string{"always"}},
+			{"scheduled", adspots.AdSpotFilter{Now: now, Effective: []adspots.EffectiveStatus{adspots.EffectiveScheduled}}, []string{"mondays", "monday"}},
+			{"within the schedule", adspots.AdSpotFilter{Now: monday, Effective: []adspots.EffectiveStatus{adspots.EffectiveActive}, Limit: 2}, []string{"mondays", "monday"}},
+			{"neither", adspots.AdSpotFilter{Now: now, Effective: []adspots.EffectiveStatus{adspots.EffectiveInactive}}, nil},
+		} {
+			spots, err := store.List(t.Context(), tc.filter)
+			if err != nil {
+				t.Fatalf("[%s] %v", tc.name, err)
+			}
+			if got := ids(spots); !slices.Equal(got, tc.expected) {
+				t.Errorf("[%s] Expected %v, got %v", tc.name, tc.expected, got)
+			}
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		store, _ := newStore(t)
+		seed(t, store)
+
+		for _, sort := range []string{adspots.SortCreatedAt, adspots.SortPriority} {
+			all, err := store.List(t.Context(), adspots.AdSpotFilter{Sort: sort})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var paged []adspots.AdSpot
+			filter := adspots.AdSpotFilter{Sort: sort, Limit: 2}
+			for {
+				page, err := store.List(t.Context(), filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				paged = append(paged, page...)
+				if len(page) < filter.Limit {
+					break
+				}
+				last := page[len(page)-1]
+				cursor := adspots.Cursor{Priority: last.Priority, CreatedAt: last.CreatedAt, ID: last.ID}
+				if sort == adspots.SortPriority {
+					cursor.Sort = sort
+				}
+				filter.After = &cursor
+			}
+			if !slices.Equal(ids(paged), ids(all)) {
+				t.Errorf("[%s] Expected pages to add up to %v, got %v", sort, ids(all), ids(paged))
+			}
+		}
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		store, _ := newStore(t)
+		seed(t, store)
+
+		spot, _ := store.Get(t.Context(), "live")
+		if spot.Version != 1 {
+			t.Errorf("Expected new ad spots to be at version 1, got %d", spot.Version)
+		}
+
+		stale := spot
+		spot.Title = "Renamed"
+		if err := store.Update(t.Context(), spot); err != nil {
+			t.Fatal(err)
+		}
+		if spot, _ = store.Get(t.Context(), "live"); spot.Version != 2 {
+			t.Errorf("Expected an update to bump the version to 2, got %d", spot.Version)
+		}
+
+		stale.Title = "Lost"
+		if err := store.Update(t.Context(), stale); !errors.Is(err, adspots.StaleAdSpot) {
+			t.Errorf("Expected StaleAdSpot updating an old version, got %v", err)
+		}
+		stale.Status = adspots.StatusPaused
+		if updated, err := store.UpdateStatus(t.Context(), stale, adspots.StatusActive); err != nil || updated {
+			t.Errorf("Expected no status update from an old version, got %v %v", updated, err)
+		}
+
+		spot.Status = adspots.StatusPaused
+		if updated, err := store.UpdateStatus(t.Context(), spot, adspots.StatusActive); err != nil || !updated {
+			t.Errorf("Expected a status update, got %v %v", updated, err)
+		}
+		if spot, _ = store.Get(t.Context(), "live"); spot.Version != 3 || spot.Title != "Renamed" {
+			t.Errorf("Expected version 3 of the renamed ad spot, got %d %q", spot.Version, spot.Title)
+		}
+
+		if _, err := store.DeactivateExpired(t.Context(), now); err != nil {
+			t.Fatal(err)
+		}
+		if spot, _ := store.Get(t.Context(), "expired"); spot.Version != 2 {
+			t.Errorf("Expected deactivation to bump the version to 2, got %d", spot.Version)
+		}
+	})
+
+	t.Run("DeactivateExpired", func(t *testing.T) {
+		store, _ := newStore(t)
+		seed(t, store)
+
+		deactivated, err := store.DeactivateExpired(t.Context(), now)
+		if err != nil || deactivated != 1 {
+			t.Fatalf("Expected 1 ad spot to be deactivated, got %d %v", deactivated, err)
+		}
+		spot, _ := store.Get(t.Context(), "expired")
+		if spot.Status != adspots.StatusDeactivated || spot.DeactivationReason != adspots.DeactivationTTLExpired ||
+			spot.DeactivatedAt == nil || spot.DeactivatedAt.String() != at(-time.Minute).String() {
+			t.Errorf("Expected the ad spot to be deactivated when it expired, got %+v", spot)
+		}
+
+		// A day later, the paused ad spot's TTL has run out too
+		if deactivated, err := store.DeactivateExpired(t.Context(), now.Add(24*time.Hour)); err != nil || deactivated != 1 {
+			t.Errorf("Expected 1 ad spot to be deactivated, got %d %v", deactivated, err)
+		}
+	})
+
+	t.Run("Timezones", func(t *testing.T) {
+		store, _ := newStore(t)
+
+		// Dates written in different offsets are ordered by the instant they
+		// stand for, not by how they are written
+		earlier := newSpot("earlier", 0)
+		earlier.CreatedAt = adspots.ISO8601(now.In(time.FixedZone("UTC+5", 5*60*60)))
+		later := newSpot("later", 0)
+		later.CreatedAt = adspots.ISO8601(now.Add(time.Hour).In(time.FixedZone("UTC-5", -5*60*60)))
+		for _, spot := range []adspots.AdSpot{earlier, later} {
+			if err := store.Create(t.Context(), spot); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		spots, err := store.List(t.Context(), adspots.AdSpotFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(spots); !slices.Equal(got, []string{"later", "earlier"}) {
+			t.Errorf("Expected the later ad spot first, got %v", got)
+		}
+		if spot, _ := store.Get(t.Context(), "earlier"); !time.Time(spot.CreatedAt).Equal(now) {
+			t.Errorf("Expected the creation date to round trip, got %s", spot.CreatedAt)
+		}
+	})
+
+	t.Run("Transactions", func(t *testing.T) {
+		store, _ := newStore(t)
+		placement := adspots.PlacementMapView
+
+		// Transactions run one at a time, so that nothing is written to the
+		// placement between counting its ad spots and writing another one
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Go(func() {
+				err := store.Transaction(t.Context(), placement, func(tx adspots.AdSpotStore) error {
+					spots, err := tx.List(t.Context(), adspots.AdSpotFilter{Placement: &placement})
+					if err != nil || len(spots) > 0 {
+						return err
+					}
+					time.Sleep(time.Millisecond)
+					spot := newSpot(fmt.Sprint("only-", i), 0)
+					spot.Placement = placement
+					return tx.Create(t.Context(), spot)
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			})
+		}
+		wg.Wait()
+
+		spots, err := store.List(t.Context(), adspots.AdSpotFilter{Placement: &placement})
+		if err != nil || len(spots) != 1 {
+			t.Errorf("Expected 1 ad spot in the placement, got %d %v", len(spots), err)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		store, _ := newStore(t)
+		seed(t, store)
+
+		// Updates racing on the same version may go stale, but every one that
+		// succeeds bumps the version
+		var updated atomic.Int64
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Go(func() {
+				if err := store.Create(t.Context(), newSpot(fmt.Sprint("concurrent-", i), 0)); err != nil {
+					t.Error(err)
+				}
+				spot, err := store.Get(t.Context(), "live")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				spot.Title = fmt.Sprint("Title ", i)
+				if err := store.Update(t.Context(), spot); err == nil {
+					updated.Add(1)
+				} else if !errors.Is(err, adspots.StaleAdSpot) {
+					t.Error(err)
+				}
+				if _, err := store.List(t.Context(), adspots.AdSpotFilter{}); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+		wg.Wait()
+
+		spots, err := store.List(t.Context(), adspots.AdSpotFilter{})
+		if err != nil || len(spots) != 25 {
+			t.Errorf("Expected 25 ad spots, got %d %v", len(spots), err)
+		}
+		if spot, _ := store.Get(t.Context(), "live"); int64(spot.Version) != 1+updated.Load() {
+			t.Errorf("Expected version %d after %d updates, got %d", 1+updated.Load(), updated.Load(), spot.Version)
+		}
+	})
+}
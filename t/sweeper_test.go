@@ -0,0 +1,115 @@
+package t
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+	"gorm.io/gorm"
+)
+
+func TestSweeper(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		db := setupDatabase(t)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		testCases := []struct {
+			name        string
+			ttl         *int
+			status      adspots.Status
+			expected    adspots.Status
+			description string
+		}{
+			{
+				name:        "active_no_ttl",
+				ttl:         nil,
+				status:      adspots.StatusActive,
+				expected:    adspots.StatusActive,
+				description: "Ad spots without TTL are never swept",
+			},
+			{
+				name:        "active_within_ttl",
+				ttl:         intPtr(120),
+				status:      adspots.StatusActive,
+				expected:    adspots.StatusActive,
+				description: "Ad spots within TTL are left alone",
+			},
+			{
+				name:        "active_expired",
+				ttl:         intPtr(30),
+				status:      adspots.StatusActive,
+				expected:    adspots.StatusDeactivated,
+				description: "Expired active ad spots are deactivated",
+			},
+			{
+				name:        "paused_expired",
+				ttl:         intPtr(30),
+				status:      adspots.StatusPaused,
+				expected:    adspots.StatusDeactivated,
+				description: "Expired paused ad spots are deactivated",
+			},
+			{
+				name:        "draft_expired",
+				ttl:         intPtr(30),
+				status:      adspots.StatusDraft,
+				expected:    adspots.StatusDraft,
+				description: "Drafts are never swept",
+			},
+		}
+
+		createdAt := time.Now()
+		for _, tc := range testCases {
+			ad := adspots.AdSpot{
+				ID:         tc.name,
+				Title:      "Test ad: " + tc.name,
+				ImageURL:   "https://example.com/image.png",
+				TTLMinutes: tc.ttl,
+				Placement:  adspots.PlacementHomeScreen,
+				CreatedAt:  adspots.ISO8601(createdAt),
+				Status:     tc.status,
+			}
+			if err := gorm.G[adspots.AdSpot](db).Create(t.Context(), &ad); err != nil {
+				t.Fatalf("Failed to insert test case %s: %v", tc.name, err)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		sweeper := adspots.NewSweeper(adspots.NewGormStore(db), time.Minute)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			sweeper.Run(ctx)
+		}()
+
+		time.Sleep(1*time.Hour + time.Second)
+		cancel()
+		<-done
+
+		for _, tc := range testCases {
+			spot, err := gorm.G[adspots.AdSpot](db).Where("id = ?", tc.name).First(t.Context())
+			if err != nil {
+				t.Fatalf("Failed to fetch test case %s: %v", tc.name, err)
+			}
+			if spot.Status != tc.expected {
+				t.Errorf("[%s] Expected status %s, got %s", tc.description, tc.expected, spot.Status)
+			}
+			if tc.expected != adspots.StatusDeactivated {
+				continue
+			}
+
+			if spot.DeactivationReason != adspots.DeactivationTTLExpired {
+				t.Errorf("[%s] Expected reason %q, got %q", tc.description, adspots.DeactivationTTLExpired, spot.DeactivationReason)
+			}
+			expiredAt := createdAt.Add(time.Duration(*tc.ttl) * time.Minute)
+			if spot.DeactivatedAt == nil || !time.Time(*spot.DeactivatedAt).Equal(expiredAt) {
+				t.Errorf("[%s] Expected deactivation date %v, got %v", tc.description, expiredAt, spot.DeactivatedAt)
+			}
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package t
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func TestTargeting(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	// Gold riders in New York or Boston, except on the oldest app version
+	targeted := createAdSpot(t, server, string(mustJSON(t, map[string]any{
+		"title":     "Lounge access",
+		"imageUrl":  "https://example.com/a.png",
+		"placement": "ride_summary",
+		"targeting": map[string]any{
+			"and": []any{
+				map[string]any{"key": "city", "in": []string{"nyc", "bos"}},
+				map[string]any{"key": "tier", "in": []string{"gold"}},
+				map[string]any{"not": map[string]any{"key": "appVersion", "in": []string{"1.0.0"}}},
+			},
+		},
+	})))
+	untargeted := createAdSpot(t, server, `{"title":"Everyone","imageUrl":"https://example.com/a.png","placement":"ride_summary"}`)
+
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{"ctx.city=nyc&ctx.tier=gold&ctx.appVersion=2.1.0", []string{targeted.ID, untargeted.ID}},
+		{"ctx.city=bos&ctx.tier=gold", []string{targeted.ID, untargeted.ID}},
+		{"ctx.city=nyc&ctx.tier=gold&ctx.appVersion=1.0.0", []string{untargeted.ID}},
+		{"ctx.city=sfo&ctx.tier=gold", []string{untargeted.ID}},
+		{"ctx.city=nyc", []string{untargeted.ID}},
+		{"", []string{untargeted.ID}},
+	} {
+		served := map[string]bool{}
+		for range 50 {
+			spot, code := serveAdSpot(t, server, "placement=ride_summary&"+tc.query)
+			if code != http.StatusOK {
+				t.Fatalf("%q: expected 200, got %d", tc.query, code)
+			}
+			served[spot.ID] = true
+		}
+		if len(served) != len(tc.expected) {
+			t.Errorf("%q: expected %d distinct ad spots, got %d", tc.query, len(tc.expected), len(served))
+		}
+		for id := range served {
+			if !slices.Contains(tc.expected, id) {
+				t.Errorf("%q: ad spot %s should not have been served", tc.query, id)
+			}
+		}
+	}
+}
+
+func TestTargetingValidation(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		targeting map[string]any
+		expected  []string
+	}{
+		{map[string]any{}, []string{"targeting: must have exactly one of and, or, not, or key with in"}},
+		{map[string]any{"and": []any{}}, []string{"targeting.and: must have at least one operand"}},
+		{
+			map[string]any{"or": []any{
+				map[string]any{"key": "city", "in": []string{"nyc"}},
+				map[string]any{"not": map[string]any{"key": "1city", "in": []string{}}},
+			}},
+			[]string{
+				"targeting.or[1].not.key: must start with a letter and only contain letters, digits and underscores",
+				"targeting.or[1].not.in: must list between 1 and 100 values",
+			},
+		},
+		{
+			map[string]any{"key": "city", "in": []string{"nyc"}, "not": map[string]any{"key": "tier", "in": []string{"gold"}}},
+			[]string{"targeting: must have exactly one of and, or, not, or key with in"},
+		},
+		{map[string]any{"key": "city", "in": []string{"nyc", ""}}, []string{"targeting.in[1]: cannot be empty"}},
+	} {
+		req := httptest.NewRequest("POST", "/adspots", jsonBody(map[string]any{
+			"title":     "Invalid",
+			"imageUrl":  "https://example.com/a.png",
+			"placement": "ride_summary",
+			"targeting": tc.targeting,
+		}))
+		w := httptest.NewRecorder()
+		server.CreateAdSpot(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for targeting %v, got %d", tc.targeting, w.Code)
+			continue
+		}
+
+		var response struct {
+			Error struct {
+				Context []string `json:"context"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if !slices.Equal(response.Error.Context, tc.expected) {
+			t.Errorf("Expected errors %q, got %q", tc.expected, response.Error.Context)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package t
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	adspots "github.com/coyotoid/admoai-take-home-challenge"
+)
+
+func createAdSpot(t *testing.T, server *adspots.Server, body string) adspots.AdSpot {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/adspots", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.CreateAdSpot(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 creating ad spot, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var spot adspots.AdSpot
+	if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return spot
+}
+
+func jsonBody(v any) io.Reader {
+	buf, _ := json.Marshal(v)
+	return bytes.NewReader(buf)
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestUpdate(t *testing.T) {
+	db := setupDatabase(t)
+	server := adspots.NewServer(adspots.NewGormStore(db))
+	defer server.Close()
+
+	original := createAdSpot(t, server, `{"title":"Tittle","imageUrl":"https://example.com/a.png","placement":"home_screen","ttlMinutes":60}`)
+
+	testCases := []struct {
+		name        string
+		method      string
+		body        string
+		code        int
+		title       string
+		placement   adspots.Placement
+		ttl         *int
+		description string
+	}{
+		{
+			name:        "patch_title",
+			method:      "PATCH",
+			body:        `{"title":"Title"}`,
+			code:        http.StatusOK,
+			title:       "Title",
+			placement:   adspots.PlacementHomeScreen,
+			ttl:         intPtr(60),
+			description: "Patching a single field should leave the others untouched",
+		},
+		{
+			name:        "patch_remove_ttl",
+			method:      "PATCH",
+			body:        `{"ttlMinutes":null}`,
+			code:        http.StatusOK,
+			title:       "Title",
+			placement:   adspots.PlacementHomeScreen,
+			ttl:         nil,
+			description: "A null value in a merge patch should clear the field",
+		},
+		{
+			name:        "patch_remove_required",
+			method:      "PATCH",
+			body:        `{"title":null}`,
+			code:        http.StatusBadRequest,
+			description: "Removing a required field should fail validation",
+		},
+		{
+			name:        "patch_id",
+			method:      "PATCH",
+			body:        `{"id":"something-else"}`,
+			code:        http.StatusBadRequest,
+			description: "The ID cannot be changed",
+		},
+		{
+			name:        "patch_unknown_field",
+			method:      "PATCH",
+			body:        `{"clicks":3}`,
+			code:        http.StatusBadRequest,
+			description: "Fields that are not editable should be rejected",
+		},
+		{
+			name:        "patch_status",
+			method:      "PATCH",
+			body:        `{"status":"deactivated"}`,
+			code:        http.StatusBadRequest,
+			description: "Status changes must go through the lifecycle endpoints",
+		},
+		{
+			name:        "put_replace",
+			method:      "PUT",
+			body:        `{"title":"Replaced","imageUrl":"https://example.com/b.png","placement":"map_view"}`,
+			code:        http.StatusOK,
+			title:       "Replaced",
+			placement:   adspots.PlacementMapView,
+			ttl:         nil,
+			description: "PUT should replace every editable field",
+		},
+		{
+			name:        "put_missing_field",
+			method:      "PUT",
+			body:        `{"title":"Replaced","placement":"map_view"}`,
+			code:        http.StatusBadRequest,
+			description: "PUT should apply the same validation rules as creation",
+		},
+		{
+			name:        "put_created_at",
+			method:      "PUT",
+			body:        `{"title":"Replaced","imageUrl":"https://example.com/b.png","placement":"map_view","createdAt":"2001-01-01T00:00:00+0000"}`,
+			code:        http.StatusBadRequest,
+			description: "The creation date cannot be changed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/adspots/"+original.ID, strings.NewReader(tc.body))
+			req.SetPathValue("id", original.ID)
+			w := httptest.NewRecorder()
+			if tc.method == "PUT" {
+				server.ReplaceAdSpot(w, req)
+			} else {
+				server.PatchAdSpot(w, req)
+			}
+
+			if w.Code != tc.code {
+				t.Fatalf("[%s] Expected %d, got %d: %s", tc.description, tc.code, w.Code, w.Body.String())
+			}
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			req = httptest.NewRequest("GET", "/adspots/"+original.ID, nil)
+			req.SetPathValue("id", original.ID)
+			w = httptest.NewRecorder()
+			server.GetAdSpot(w, req)
+
+			var spot adspots.AdSpot
+			if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if spot.Title != tc.title || spot.Placement != tc.placement {
+				t.Errorf("[%s] Got title %q and placement %v", tc.description, spot.Title, spot.Placement)
+			}
+			if (spot.TTLMinutes == nil) != (tc.ttl == nil) || (tc.ttl != nil && *spot.TTLMinutes != *tc.ttl) {
+				t.Errorf("[%s] Got TTL %v, expected %v", tc.description, spot.TTLMinutes, tc.ttl)
+			}
+			if spot.ID != original.ID || spot.CreatedAt.String() != original.CreatedAt.String() {
+				t.Errorf("[%s] ID or creation date changed", tc.description)
+			}
+		})
+	}
+}
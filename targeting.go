@@ -0,0 +1,123 @@
+package adspots
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Targeting is a boolean expression over the attributes of a serving request,
+// such as the rider's city or app version. Each node sets exactly one of And,
+// Or, Not or Key, and Key nodes match when the attribute is one of In.
+type Targeting struct {
+	And []Targeting `json:"and,omitempty"`
+	Or  []Targeting `json:"or,omitempty"`
+	Not *Targeting  `json:"not,omitempty"`
+	Key string      `json:"key,omitempty"`
+	In  []string    `json:"in,omitempty"`
+}
+
+// Targeting expressions are kept small, since every one of them is evaluated
+// for each serving request.
+const (
+	maxTargetingDepth  = 8
+	maxTargetingValues = 100
+)
+
+// targetingContextPrefix marks the query parameters of /serve that make up
+// the targeting context, as in ?ctx.city=nyc&ctx.tier=gold.
+const targetingContextPrefix = "ctx."
+
+var targetingKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+
+// validate checks the expression, naming each invalid node by its path from
+// the root, as in "targeting.and[1].not.in".
+func (tg Targeting) validate(path string, depth int) []string {
+	var validationErrors []string
+	fail := func(at, message string) {
+		validationErrors = append(validationErrors, fmt.Sprintf("%s: %s", at, message))
+	}
+
+	set := 0
+	for _, isSet := range []bool{tg.And != nil, tg.Or != nil, tg.Not != nil, tg.Key != "" || tg.In != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		fail(path, "must have exactly one of and, or, not, or key with in")
+		return validationErrors
+	}
+	if depth > maxTargetingDepth {
+		fail(path, fmt.Sprintf("expressions cannot be nested more than %d levels deep", maxTargetingDepth))
+		return validationErrors
+	}
+
+	switch {
+	case tg.And != nil || tg.Or != nil:
+		operator, operands := "and", tg.And
+		if tg.Or != nil {
+			operator, operands = "or", tg.Or
+		}
+		if len(operands) == 0 {
+			fail(path+"."+operator, "must have at least one operand")
+		}
+		for i, operand := range operands {
+			validationErrors = append(validationErrors, operand.validate(fmt.Sprintf("%s.%s[%d]", path, operator, i), depth+1)...)
+		}
+	case tg.Not != nil:
+		validationErrors = append(validationErrors, tg.Not.validate(path+".not", depth+1)...)
+	default:
+		if !targetingKey.MatchString(tg.Key) {
+			fail(path+".key", "must start with a letter and only contain letters, digits and underscores")
+		}
+		if len(tg.In) == 0 || len(tg.In) > maxTargetingValues {
+			fail(path+".in", fmt.Sprintf("must list between 1 and %d values", maxTargetingValues))
+		}
+		for i, value := range tg.In {
+			if value == "" {
+				fail(fmt.Sprintf("%s.in[%d]", path, i), "cannot be empty")
+			}
+		}
+	}
+	return validationErrors
+}
+
+// matches evaluates the expression against the request's attributes. A key
+// missing from the context matches none of its values.
+func (tg Targeting) matches(attributes map[string]string) bool {
+	switch {
+	case tg.And != nil:
+		for _, operand := range tg.And {
+			if !operand.matches(attributes) {
+				return false
+			}
+		}
+		return true
+	case tg.Or != nil:
+		for _, operand := range tg.Or {
+			if operand.matches(attributes) {
+				return true
+			}
+		}
+		return false
+	case tg.Not != nil:
+		return !tg.Not.matches(attributes)
+	}
+
+	value, ok := attributes[tg.Key]
+	return ok && slices.Contains(tg.In, value)
+}
+
+// parseTargetingContext collects the ctx.* query parameters of the request.
+func parseTargetingContext(r *http.Request) map[string]string {
+	attributes := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		if key, ok := strings.CutPrefix(name, targetingContextPrefix); ok && len(values) > 0 {
+			attributes[key] = values[0]
+		}
+	}
+	return attributes
+}
@@ -1,7 +1,10 @@
 package adspots
 
 import (
+	"cmp"
+	"context"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,51 +15,131 @@ import (
 )
 
 type (
-	Placement int
-	Status    bool
-	ISO8601   time.Time
+	Placement          int
+	Status             int
+	DeactivationReason string
+	EffectiveStatus    string
+	ISO8601            time.Time
 
 	Server struct {
-		db  *gorm.DB
-		mux *http.ServeMux
-		rl  *RateLimiter
+		store      Store
+		mux        *http.ServeMux
+		rl         *RateLimiter
+		selector   Selector
+		cache      *eligibleCache
+		geo        *geoIndex
+		placements *placementRegistry
 	}
 
 	AdSpot struct {
-		ID            string    `json:"id" gorm:"primaryKey"`
-		Title         string    `json:"title"`
-		ImageURL      string    `json:"imageUrl"`
-		Placement     Placement `json:"placement"`
-		Status        *Status   `json:"status"` // zero values bit my ass here lol
-		TTLMinutes    *int      `json:"ttlMinutes,omitempty"`
-		CreatedAt     ISO8601   `json:"createdAt"`
-		DeactivatedAt *ISO8601  `json:"deactivatedAt,omitempty"`
+		ID                 string             `json:"id" gorm:"primaryKey"`
+		Title              string             `json:"title"`
+		ImageURL           string             `json:"imageUrl"`
+		ImageSize          *Dimensions        `json:"imageSize,omitempty" gorm:"serializer:json"`
+		Placement          Placement          `json:"placement"`
+		CampaignID         *string            `json:"campaignId,omitempty" gorm:"index"`
+		Priority           int                `json:"priority" gorm:"index"`
+		Weight             int                `json:"weight" gorm:"default:1"`
+		Status             Status             `json:"status"`
+		TTLMinutes         *int               `json:"ttlMinutes,omitempty"`
+		CreatedAt          ISO8601            `json:"createdAt"`
+		DeactivatedAt      *ISO8601           `json:"deactivatedAt,omitempty"`
+		DeactivationReason DeactivationReason `json:"deactivationReason,omitempty"`
+		ExpiresAt          *ISO8601           `json:"expiresAt,omitempty" gorm:"index"`
+		MaxImpressions     *int64             `json:"maxImpressions,omitempty"`
+		FrequencyCap       *FrequencyCap      `json:"frequencyCap,omitempty" gorm:"serializer:json"`
+		CapState           *CapState          `json:"capState,omitempty" gorm:"-"`
+		StartAt            *ISO8601           `json:"startAt,omitempty" gorm:"index"`
+		EndAt              *ISO8601           `json:"endAt,omitempty"`
+		Schedule           *Schedule          `json:"schedule,omitempty" gorm:"serializer:json"`
+		Geo                *GeoTarget         `json:"geo,omitempty" gorm:"serializer:json"`
+		// GeoBounds is the bounding box of Geo, kept in sync with it so that
+		// ad spots can be listed by point in SQL.
+		GeoBounds  *GeoBounds `json:"-" gorm:"embedded;embeddedPrefix:geo_"`
+		Targeting  *Targeting `json:"targeting,omitempty" gorm:"serializer:json"`
+		Creatives  []Creative `json:"creatives,omitempty" gorm:"serializer:json"`
+		CreativeID string     `json:"creativeId,omitempty" gorm:"-"`
+		// Version counts the changes to the ad spot, starting from 1. Clients
+		// see it as the ETag header rather than in the body.
+		Version int `json:"-" gorm:"default:1"`
+		// CampaignInactive is set by stores when the ad spot's campaign isn't
+		// active, which keeps it from being served. It isn't stored.
+		CampaignInactive bool `json:"-" gorm:"->;-:migration"`
+		// placementName is the name of the placement, which only the server
+		// knows unless it is a built-in one.
+		placementName string
 	}
 	CreatePayload struct {
-		Title      *string `json:"title"`
-		ImageURL   *string `json:"imageUrl"`
-		Placement  *string `json:"placement"`
-		TTLMinutes *int    `json:"ttlMinutes"`
+		Title          *string           `json:"title"`
+		ImageURL       *string           `json:"imageUrl"`
+		ImageSize      *Dimensions       `json:"imageSize"`
+		Placement      *string           `json:"placement"`
+		CampaignID     *string           `json:"campaignId"`
+		Priority       *int              `json:"priority"`
+		Weight         *int              `json:"weight"`
+		TTLMinutes     *int              `json:"ttlMinutes"`
+		Status         *Status           `json:"status"`
+		MaxImpressions *int64            `json:"maxImpressions"`
+		FrequencyCap   *FrequencyCap     `json:"frequencyCap"`
+		StartAt        *ISO8601          `json:"startAt"`
+		EndAt          *ISO8601          `json:"endAt"`
+		Schedule       *Schedule         `json:"schedule"`
+		Geo            *GeoTarget        `json:"geo"`
+		Targeting      *Targeting        `json:"targeting"`
+		Creatives      []CreativePayload `json:"creatives"`
+	}
+	// UpdatePayload is accepted by PUT and PATCH. ID and CreatedAt may be
+	// echoed back by clients, but must match the stored values.
+	UpdatePayload struct {
+		CreatePayload
+		ID        *string  `json:"id"`
+		CreatedAt *ISO8601 `json:"createdAt"`
 	}
 )
 
+// The built-in placements. Others are stored in the placements table.
 const (
 	PlacementHomeScreen  Placement = 1
 	PlacementRideSummary Placement = 2
 	PlacementMapView     Placement = 3
 )
 
-var (
-	statusActive   Status  = true
-	statusInactive Status  = false
-	StatusActive   *Status = &statusActive
-	StatusInactive *Status = &statusInactive
+// Ad spots move through these states according to statusTransitions.
+const (
+	StatusDraft       Status = 1
+	StatusActive      Status = 2
+	StatusPaused      Status = 3
+	StatusDeactivated Status = 4
+	StatusArchived    Status = 5
+)
+
+// Ad spots deactivated by the sweeper are marked as expired, whether their
+// TTL ran out or their flight ended.
+const (
+	DeactivationManual     DeactivationReason = "manual"
+	DeactivationTTLExpired DeactivationReason = "ttl_expired"
 )
 
+// The effective status is what clients should act upon: it folds expiry
+// into the stored lifecycle status. Active ad spots are scheduled until their
+// flight starts, and between the windows of their weekly schedule.
+const (
+	EffectiveActive    EffectiveStatus = "active"
+	EffectiveScheduled EffectiveStatus = "scheduled"
+	EffectiveExpired   EffectiveStatus = "expired"
+	EffectiveInactive  EffectiveStatus = "inactive"
+)
+
+// MaxWeight bounds the weight of an ad spot, which sets its share of the
+// impressions among the ad spots of the same priority.
+const MaxWeight = 10000
+
 var InvalidPlacement = errors.New("invalid placement value")
 var InvalidStatus = errors.New("invalid status value")
 
-func NewServer(db *gorm.DB) *Server {
+// NewServer returns a server keeping its ad spots, and everything else, in
+// store.
+func NewServer(store Store) *Server {
 	// Create rate limiter with sensible defaults
 	rateLimiter := NewRateLimiter(RateLimiterConfig{
 		RequestsPerSecond: 10,              // 10 requests per second
@@ -65,16 +148,44 @@ func NewServer(db *gorm.DB) *Server {
 	})
 
 	server := &Server{
-		db: db,
-		rl: rateLimiter,
+		store:      store,
+		rl:         rateLimiter,
+		selector:   WeightedSelector{},
+		cache:      newEligibleCache(eligibleCacheTTL),
+		geo:        newGeoIndex(eligibleCacheTTL),
+		placements: newPlacementRegistry(store),
 	}
 
 	mux := http.NewServeMux()
-	// Apply rate limiting to all endpoints
-	mux.HandleFunc("POST /adspots", server.rl.RateLimitHandlerFunc(server.CreateAdSpot))
+	// Apply rate limiting to all endpoints, and let POST requests be retried
+	mux.HandleFunc("POST /adspots", server.rl.RateLimitHandlerFunc(server.idempotent(server.CreateAdSpot)))
 	mux.HandleFunc("GET /adspots/{id}", server.rl.RateLimitHandlerFunc(server.GetAdSpot))
-	mux.HandleFunc("POST /adspots/{id}/deactivate", server.rl.RateLimitHandlerFunc(server.DeactivateAdSpot))
+	mux.HandleFunc("PUT /adspots/{id}", server.rl.RateLimitHandlerFunc(server.ReplaceAdSpot))
+	mux.HandleFunc("PATCH /adspots/{id}", server.rl.RateLimitHandlerFunc(server.PatchAdSpot))
+	mux.HandleFunc("POST /adspots/{id}/activate", server.rl.RateLimitHandlerFunc(server.idempotent(server.ActivateAdSpot)))
+	mux.HandleFunc("POST /adspots/{id}/pause", server.rl.RateLimitHandlerFunc(server.idempotent(server.PauseAdSpot)))
+	mux.HandleFunc("POST /adspots/{id}/deactivate", server.rl.RateLimitHandlerFunc(server.idempotent(server.DeactivateAdSpot)))
+	mux.HandleFunc("POST /adspots/{id}/archive", server.rl.RateLimitHandlerFunc(server.idempotent(server.ArchiveAdSpot)))
+	mux.HandleFunc("POST /adspots/{id}/impressions", server.rl.RateLimitHandlerFunc(server.idempotent(server.RecordImpression)))
+	mux.HandleFunc("POST /adspots/{id}/clicks", server.rl.RateLimitHandlerFunc(server.idempotent(server.RecordClick)))
+	mux.HandleFunc("POST /events", server.rl.RateLimitHandlerFunc(server.idempotent(server.RecordEvents)))
+	mux.HandleFunc("GET /adspots/{id}/schedule/preview", server.rl.RateLimitHandlerFunc(server.PreviewSchedule))
+	mux.HandleFunc("GET /adspots/{id}/stats", server.rl.RateLimitHandlerFunc(server.AdSpotStats))
+	mux.HandleFunc("GET /placements", server.rl.RateLimitHandlerFunc(server.ListPlacements))
+	mux.HandleFunc("POST /placements", server.rl.RateLimitHandlerFunc(server.idempotent(server.CreatePlacement)))
+	mux.HandleFunc("GET /reports/placements", server.rl.RateLimitHandlerFunc(server.PlacementReport))
+	mux.HandleFunc("POST /advertisers", server.rl.RateLimitHandlerFunc(server.idempotent(server.CreateAdvertiser)))
+	mux.HandleFunc("GET /advertisers", server.rl.RateLimitHandlerFunc(server.ListAdvertisers))
+	mux.HandleFunc("GET /advertisers/{id}", server.rl.RateLimitHandlerFunc(server.GetAdvertiser))
+	mux.HandleFunc("PATCH /advertisers/{id}", server.rl.RateLimitHandlerFunc(server.PatchAdvertiser))
+	mux.HandleFunc("DELETE /advertisers/{id}", server.rl.RateLimitHandlerFunc(server.DeleteAdvertiser))
+	mux.HandleFunc("POST /campaigns", server.rl.RateLimitHandlerFunc(server.idempotent(server.CreateCampaign)))
+	mux.HandleFunc("GET /campaigns", server.rl.RateLimitHandlerFunc(server.ListCampaigns))
+	mux.HandleFunc("GET /campaigns/{id}", server.rl.RateLimitHandlerFunc(server.GetCampaign))
+	mux.HandleFunc("PATCH /campaigns/{id}", server.rl.RateLimitHandlerFunc(server.PatchCampaign))
+	mux.HandleFunc("DELETE /campaigns/{id}", server.rl.RateLimitHandlerFunc(server.DeleteCampaign))
 	mux.HandleFunc("GET /adspots", server.rl.RateLimitHandlerFunc(server.ListAdSpots))
+	mux.HandleFunc("GET /serve", server.rl.RateLimitHandlerFunc(server.ServeAdSpot))
 	server.mux = mux
 
 	return server
@@ -84,30 +195,31 @@ func (s *Server) Mux() *http.ServeMux {
 	return s.mux
 }
 
+// Close stops the server's background goroutines.
+func (s *Server) Close() {
+	s.rl.Stop()
+}
+
+// String returns the name of a built-in placement. The names of the others
+// are stored, and known to the server's placement registry.
 func (p Placement) String() string {
-	switch p {
-	case PlacementHomeScreen:
-		return "home_screen"
-	case PlacementRideSummary:
-		return "ride_summary"
-	case PlacementMapView:
-		return "map_view"
+	for _, placement := range builtinPlacements {
+		if placement.ID == p {
+			return placement.Name
+		}
 	}
 	return "invalid"
 }
 
+// Parse reads the name of a built-in placement, like String writes it.
 func (p *Placement) Parse(value string) error {
-	switch value {
-	case "home_screen":
-		*p = PlacementHomeScreen
-	case "ride_summary":
-		*p = PlacementRideSummary
-	case "map_view":
-		*p = PlacementMapView
-	default:
-		return InvalidPlacement
+	for _, placement := range builtinPlacements {
+		if placement.Name == value {
+			*p = placement.ID
+			return nil
+		}
 	}
-	return nil
+	return InvalidPlacement
 }
 
 func (p Placement) MarshalJSON() ([]byte, error) {
@@ -124,42 +236,77 @@ func (p *Placement) UnmarshalJSON(buf []byte) error {
 	return p.Parse(value)
 }
 
-func (s Status) MarshalJSON() ([]byte, error) {
-	if s {
-		return []byte("\"active\""), nil
+func (s Status) String() string {
+	switch s {
+	case StatusDraft:
+		return "draft"
+	case StatusActive:
+		return "active"
+	case StatusPaused:
+		return "paused"
+	case StatusDeactivated:
+		return "deactivated"
+	case StatusArchived:
+		return "archived"
 	}
-	return []byte("\"inactive\""), nil
+	return "invalid"
 }
 
-func (s *Status) UnmarshalJSON(buf []byte) error {
-	value := strings.Trim(string(buf), `"`)
+func (s *Status) Parse(value string) error {
 	switch value {
+	case "draft":
+		*s = StatusDraft
 	case "active":
-		*s = true
-	case "inactive":
-		*s = false
+		*s = StatusActive
+	case "paused":
+		*s = StatusPaused
+	case "deactivated", "inactive":
+		// "inactive" predates the lifecycle and is kept for older clients
+		*s = StatusDeactivated
+	case "archived":
+		*s = StatusArchived
 	default:
 		return InvalidStatus
 	}
-
 	return nil
 }
 
+func (s Status) MarshalJSON() ([]byte, error) {
+	return fmt.Appendf([]byte{}, "%q", s.String()), nil
+}
+
+func (s *Status) UnmarshalJSON(buf []byte) error {
+	value := strings.Trim(string(buf), `"`)
+	return s.Parse(value)
+}
+
+// Scan reads the status name, as well as the boolean that was stored before
+// the lifecycle was introduced, which migrations rewrite as names.
 func (s *Status) Scan(value any) error {
 	if value == nil {
 		return nil
 	}
 
 	switch v := value.(type) {
+	case string:
+		return s.Parse(v)
+	case []byte:
+		return s.Parse(string(v))
 	case int64:
 		switch v {
 		case 0:
-			*s = false
+			*s = StatusDeactivated
 		case 1:
-			*s = true
+			*s = StatusActive
+		default:
+			return fmt.Errorf("%w: %d", InvalidStatus, v)
 		}
 	case bool:
-		*s = Status(v)
+		if v {
+			*s = StatusActive
+		} else {
+			*s = StatusDeactivated
+		}
 	default:
 		return fmt.Errorf("cannot scan %T into Status", value)
 	}
@@ -168,7 +315,11 @@ func (s *Status) Scan(value any) error {
 }
 
 func (s Status) Value() (driver.Value, error) {
-	return bool(s), nil
+	return s.String(), nil
+}
+
+func (Status) GormDataType() string {
+	return "string"
 }
 
 func (tm ISO8601) String() string {
@@ -179,8 +330,7 @@ func (tm ISO8601) MarshalJSON() ([]byte, error) {
 	return fmt.Appendf([]byte{}, "%q", tm.String()), nil
 }
 
-func (tm *ISO8601) UnmarshalJSON(buf []byte) error {
-	value := strings.Trim(string(buf), `"`)
+func (tm *ISO8601) Parse(value string) error {
 	tm_new, err := time.Parse("2006-01-02T15:04:05-0700", value)
 	if err != nil {
 		return err
@@ -189,42 +339,329 @@ func (tm *ISO8601) UnmarshalJSON(buf []byte) error {
 	return nil
 }
 
+func (tm *ISO8601) UnmarshalJSON(buf []byte) error {
+	value := strings.Trim(string(buf), `"`)
+	return tm.Parse(value)
+}
+
+// storedTimeLayouts are the formats dates may be stored as in text columns:
+// the one go-sqlite3 writes, and the API's own, which was stored before dates
+// became timestamps.
+var storedTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05-0700",
+}
+
 func (tm *ISO8601) Scan(value any) error {
 	if value == nil {
 		return nil
 	}
 
+	var text string
 	switch v := value.(type) {
-	case string:
-		tm_new, err := time.Parse("2006-01-02T15:04:05-0700", v)
-		if err != nil {
-			return err
-		}
-		*tm = ISO8601(tm_new)
-		return nil
-	case []byte:
-		tm_new, err := time.Parse("2006-01-02T15:04:05-0700", string(v))
-		if err != nil {
-			return err
-		}
-		*tm = ISO8601(tm_new)
-		return nil
 	case time.Time:
 		*tm = ISO8601(v)
 		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
 	default:
 		return fmt.Errorf("cannot scan %T into ISO8601", value)
 	}
+
+	var err error
+	for _, layout := range storedTimeLayouts {
+		var tm_new time.Time
+		if tm_new, err = time.Parse(layout, text); err == nil {
+			*tm = ISO8601(tm_new)
+			return nil
+		}
+	}
+	return err
 }
 
+// Value stores the date as a UTC timestamp, rounded down to the second like
+// the API reports it, so that dates compare the same in SQL and in JSON.
 func (tm ISO8601) Value() (driver.Value, error) {
-	return tm.String(), nil
+	return time.Time(tm).Truncate(time.Second).UTC(), nil
+}
+
+// utc returns the date in UTC, or nil if there is none.
+func (tm *ISO8601) utc() *ISO8601 {
+	if tm == nil {
+		return nil
+	}
+	converted := ISO8601(time.Time(*tm).UTC())
+	return &converted
+}
+
+func (ISO8601) GormDataType() string {
+	return "time"
+}
+
+// validate checks that every required field is present and well-formed,
+// returning the placement found in the registry along with any validation
+// errors.
+func (p CreatePayload) validate(ctx context.Context, placements *placementRegistry) (Placement, []string) {
+	var validationErrors []string
+	if p.Title == nil {
+		validationErrors = append(validationErrors, "Title field cannot be missing")
+	}
+	if p.ImageURL == nil {
+		validationErrors = append(validationErrors, "Image URL field cannot be missing")
+	}
+	if p.ImageSize != nil && (p.ImageSize.Width <= 0 || p.ImageSize.Height <= 0) {
+		validationErrors = append(validationErrors, "Image size field must have a positive width and height")
+	}
+	var place Placement
+	if p.Placement == nil {
+		validationErrors = append(validationErrors, "Placement field cannot be missing")
+	} else if id, ok := placements.lookup(ctx, *p.Placement); !ok {
+		validationErrors = append(validationErrors, "Invalid value for placement field")
+	} else {
+		place = id
+	}
+	if p.Weight != nil && (*p.Weight < 1 || *p.Weight > MaxWeight) {
+		validationErrors = append(validationErrors, fmt.Sprintf("Weight field must be between 1 and %d", MaxWeight))
+	}
+	if p.MaxImpressions != nil && *p.MaxImpressions <= 0 {
+		validationErrors = append(validationErrors, "Max impressions field must be positive")
+	}
+	if p.FrequencyCap != nil {
+		validationErrors = append(validationErrors, p.FrequencyCap.validate()...)
+	}
+	if p.StartAt != nil && p.EndAt != nil && !time.Time(*p.StartAt).Before(time.Time(*p.EndAt)) {
+		validationErrors = append(validationErrors, "Start date must be before end date")
+	}
+	if p.Schedule != nil {
+		validationErrors = append(validationErrors, p.Schedule.validate()...)
+	}
+	if p.Geo != nil {
+		validationErrors = append(validationErrors, p.Geo.validate()...)
+	}
+	if p.Targeting != nil {
+		validationErrors = append(validationErrors, p.Targeting.validate("targeting", 0)...)
+	}
+	if p.Creatives != nil {
+		validationErrors = append(validationErrors, validateCreatives(p.Creatives)...)
+	}
+	return place, validationErrors
+}
+
+// validateCreate additionally checks the initial status, which may only be
+// draft or active.
+func (p CreatePayload) validateCreate(ctx context.Context, placements *placementRegistry) (Placement, []string) {
+	place, validationErrors := p.validate(ctx, placements)
+	if p.Status != nil && *p.Status != StatusDraft && *p.Status != StatusActive {
+		validationErrors = append(validationErrors, "Ad spots can only be created as draft or active")
+	}
+	return place, validationErrors
+}
+
+// validate checks the update against the stored ad spot, rejecting any
+// attempt to change its ID or creation time.
+func (p UpdatePayload) validate(ctx context.Context, placements *placementRegistry, current AdSpot) (Placement, []string) {
+	place, validationErrors := p.CreatePayload.validate(ctx, placements)
+	if p.ID != nil && *p.ID != current.ID {
+		validationErrors = append(validationErrors, "ID field cannot be changed")
+	}
+	if p.CreatedAt != nil && !time.Time(*p.CreatedAt).Equal(time.Time(current.CreatedAt)) {
+		validationErrors = append(validationErrors, "Creation date field cannot be changed")
+	}
+	if p.Status != nil && *p.Status != current.Status {
+		validationErrors = append(validationErrors, "Status can only be changed through the lifecycle endpoints")
+	}
+	return place, validationErrors
+}
+
+// payload returns the editable fields of the ad spot in the shape clients
+// send them, which is what merge patches are applied against.
+func (a AdSpot) payload() CreatePayload {
+	placement := a.placementString()
+	return CreatePayload{
+		Title:          &a.Title,
+		ImageURL:       &a.ImageURL,
+		ImageSize:      a.ImageSize,
+		Placement:      &placement,
+		CampaignID:     a.CampaignID,
+		Priority:       &a.Priority,
+		Weight:         &a.Weight,
+		TTLMinutes:     a.TTLMinutes,
+		MaxImpressions: a.MaxImpressions,
+		FrequencyCap:   a.FrequencyCap,
+		StartAt:        a.StartAt,
+		EndAt:          a.EndAt,
+		Schedule:       a.Schedule,
+		Geo:            a.Geo,
+		Targeting:      a.Targeting,
+		Creatives:      creativePayloads(a.Creatives),
+	}
+}
+
+// editableColumns are the columns written when an ad spot is updated.
+var editableColumns = []string{
+	"title", "image_url", "image_size", "placement", "campaign_id", "priority", "weight", "ttl_minutes", "expires_at",
+	"max_impressions", "frequency_cap", "start_at", "end_at", "schedule", "geo",
+	"geo_south", "geo_west", "geo_north", "geo_east", "targeting", "creatives",
+}
+
+// apply overwrites the editable fields of the ad spot with a validated payload.
+func (a *AdSpot) apply(p CreatePayload, place Placement) {
+	a.Title = *p.Title
+	a.ImageURL = *p.ImageURL
+	a.ImageSize = p.ImageSize
+	a.Placement = place
+	a.CampaignID = p.CampaignID
+	a.Priority = 0
+	if p.Priority != nil {
+		a.Priority = *p.Priority
+	}
+	a.Weight = 1
+	if p.Weight != nil {
+		a.Weight = *p.Weight
+	}
+	a.TTLMinutes = p.TTLMinutes
+	a.MaxImpressions = p.MaxImpressions
+	a.FrequencyCap = p.FrequencyCap
+	a.StartAt = p.StartAt.utc()
+	a.EndAt = p.EndAt.utc()
+	a.Schedule = p.Schedule
+	a.Geo = p.Geo
+	a.Targeting = p.Targeting
+	a.Creatives = creativesOf(p.Creatives)
+	a.derive()
+}
+
+// BeforeCreate keeps the derived columns in sync.
+func (a *AdSpot) BeforeCreate(tx *gorm.DB) error {
+	a.derive()
+	return nil
+}
+
+// derive fills in the columns persisted so that ad spots can be filtered in
+// SQL: the expiry date, from the TTL and end date, and the bounding box of
+// the geo target.
+func (a *AdSpot) derive() {
+	a.ExpiresAt = a.expiry()
+	a.GeoBounds = a.Geo.box()
+}
+
+// expiry returns the moment the ad spot stops being served, which is when
+// either its TTL runs out or its flight ends, or nil if it has neither.
+func (a AdSpot) expiry() *ISO8601 {
+	var expiresAt *ISO8601
+	if a.TTLMinutes != nil && *a.TTLMinutes != 0 {
+		ttlEnd := ISO8601(time.Time(a.CreatedAt).Add(time.Duration(*a.TTLMinutes) * time.Minute))
+		expiresAt = &ttlEnd
+	}
+	if a.EndAt != nil && (expiresAt == nil || time.Time(*a.EndAt).Before(time.Time(*expiresAt))) {
+		expiresAt = a.EndAt
+	}
+	return expiresAt
 }
 
 func (a AdSpot) IsExpired() bool {
-	if a.TTLMinutes == nil || *a.TTLMinutes == 0 {
+	return a.expiredAt(time.Now())
+}
+
+func (a AdSpot) expiredAt(now time.Time) bool {
+	expiresAt := a.expiry()
+	if expiresAt == nil {
+		return false
+	}
+	return now.After(time.Time(*expiresAt))
+}
+
+// IsScheduled reports whether the ad spot's flight has yet to start.
+func (a AdSpot) IsScheduled() bool {
+	return a.scheduledAt(time.Now())
+}
+
+func (a AdSpot) scheduledAt(now time.Time) bool {
+	return a.StartAt != nil && now.Before(time.Time(*a.StartAt))
+}
+
+// offScheduleAt reports whether the instant falls outside the windows of the
+// ad spot's weekly schedule, if it has one.
+func (a AdSpot) offScheduleAt(now time.Time) bool {
+	return a.Schedule != nil && !a.Schedule.activeAt(now)
+}
+
+// IsLive reports whether the ad spot can be served right now: it must be
+// active, within its flight and, if it has one, within its weekly schedule.
+func (a AdSpot) IsLive() bool {
+	if a.Status != StatusActive || a.IsExpired() || a.IsScheduled() {
 		return false
 	}
-	expirationTime := time.Time(a.CreatedAt).Add(time.Duration(*a.TTLMinutes) * time.Minute)
-	return time.Now().After(expirationTime)
+	return !a.offScheduleAt(time.Now())
+}
+
+// EffectiveStatus reports whether the ad spot is actually being served. Ad
+// spots that expired count as expired until archived, whether or not the
+// sweeper has deactivated them yet, and those of inactive campaigns count as
+// inactive.
+func (a AdSpot) EffectiveStatus() EffectiveStatus {
+	return a.effectiveStatusAt(time.Now())
+}
+
+// ownStatusAt returns the effective status of the ad spot regardless of its
+// campaign, which is what AdSpotFilter.Effective selects on.
+func (a AdSpot) ownStatusAt(now time.Time) EffectiveStatus {
+	a.CampaignInactive = false
+	return a.effectiveStatusAt(now)
+}
+
+func (a AdSpot) effectiveStatusAt(now time.Time) EffectiveStatus {
+	switch {
+	case a.Status == StatusArchived:
+		return EffectiveInactive
+	case a.Status == StatusActive || a.Status == StatusPaused || a.DeactivationReason == DeactivationTTLExpired:
+		if a.expiredAt(now) {
+			return EffectiveExpired
+		}
+	}
+
+	switch {
+	case a.Status == StatusActive && a.CampaignInactive:
+		return EffectiveInactive
+	case a.Status == StatusActive && (a.scheduledAt(now) || a.offScheduleAt(now)):
+		return EffectiveScheduled
+	case a.Status == StatusActive:
+		return EffectiveActive
+	}
+	return EffectiveInactive
+}
+
+// placementString returns the name of the ad spot's placement, as named by
+// the server.
+func (a AdSpot) placementString() string {
+	return cmp.Or(a.placementName, a.Placement.String())
+}
+
+func (a AdSpot) MarshalJSON() ([]byte, error) {
+	type plain AdSpot
+	return json.Marshal(struct {
+		plain
+		Placement       string          `json:"placement"`
+		EffectiveStatus EffectiveStatus `json:"effectiveStatus"`
+	}{plain(a), a.placementString(), a.EffectiveStatus()})
+}
+
+// UnmarshalJSON reads ad spots as MarshalJSON writes them. Placements other
+// than the built-in ones are only known to the server by name, so their ID is
+// left unset.
+func (a *AdSpot) UnmarshalJSON(buf []byte) error {
+	type plain AdSpot
+	decoded := struct {
+		*plain
+		Placement string `json:"placement"`
+	}{plain: (*plain)(a)}
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		return err
+	}
+	a.placementName = decoded.Placement
+	a.Placement.Parse(decoded.Placement)
+	return nil
 }
@@ -1,7 +1,9 @@
 package adspots
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 )
 
@@ -11,3 +13,81 @@ func JSONError(w http.ResponseWriter, err any, code int) {
 	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(map[string]any{"error": err})
 }
+
+func JSONResponse(w http.ResponseWriter, v any, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// mergePatch applies an RFC 7396 JSON merge patch to a decoded JSON document.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], value)
+		}
+	}
+	return t
+}
+
+// decodeStrict decodes a JSON payload, rejecting unknown fields. If it fails,
+// an error response is written and ok is false.
+func decodeStrict(w http.ResponseWriter, body io.Reader, v any) (ok bool) {
+	d := json.NewDecoder(body)
+	d.DisallowUnknownFields()
+
+	if err := d.Decode(v); err != nil {
+		JSONError(w, map[string]any{
+			"what":    "Failed to decode JSON payload",
+			"context": err.Error(),
+		}, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// decodeMergePatch applies the JSON merge patch read from body to current, and
+// decodes the result into v. If it fails, an error response is written and ok
+// is false.
+func decodeMergePatch(w http.ResponseWriter, body io.Reader, current, v any) (ok bool) {
+	var patch any
+	if err := json.NewDecoder(body).Decode(&patch); err != nil {
+		JSONError(w, map[string]any{
+			"what":    "Failed to decode JSON payload",
+			"context": err.Error(),
+		}, http.StatusBadRequest)
+		return false
+	}
+	if _, isObject := patch.(map[string]any); !isObject {
+		JSONError(w, map[string]any{
+			"what": "Merge patch must be a JSON object",
+		}, http.StatusBadRequest)
+		return false
+	}
+
+	var document any
+	buf, _ := json.Marshal(current)
+	json.Unmarshal(buf, &document)
+
+	merged, err := json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		JSONError(w, map[string]any{
+			"what":    "Failed to apply merge patch",
+			"context": err.Error(),
+		}, http.StatusBadRequest)
+		return false
+	}
+
+	return decodeStrict(w, bytes.NewReader(merged), v)
+}